@@ -0,0 +1,36 @@
+// Command gencert writes a self-signed certificate for local
+// development:
+//
+//	go run ./cmd/gencert -hosts localhost,127.0.0.1 -out certs
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/suman7383/networking-from-scratch/tlsutil"
+)
+
+func main() {
+	hosts := flag.String("hosts", strings.Join(tlsutil.DefaultHosts, ","), "comma separated DNS names and IP addresses")
+	out := flag.String("out", "certs", "directory to write server.crt and server.key to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	certFile := filepath.Join(*out, "server.crt")
+	keyFile := filepath.Join(*out, "server.key")
+
+	if err := tlsutil.WriteSelfSigned(certFile, keyFile, strings.Split(*hosts, ",")...); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("wrote %s and %s\n", certFile, keyFile)
+}
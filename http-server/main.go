@@ -1,31 +1,58 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/suman7383/networking-from-scratch/httpcore"
+	"github.com/suman7383/networking-from-scratch/tlsutil"
 )
 
+// shutdownTimeout is how long in-flight requests get on Ctrl+C
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 
 	if err := run(os.Args); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-
-	run(os.Args)
 }
 
 func run(args []string) error {
-	if len(args) < 2 {
-		return fmt.Errorf("Expected 2 arguments got %d\n", len(args))
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	useTLS := flags.Bool("tls", false, "serve HTTPS")
+	certFile := flags.String("cert", "", "certificate file (a self-signed one is generated if empty)")
+	keyFile := flags.String("key", "", "private key file")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 {
+		return fmt.Errorf("Expected a port argument\n")
 	}
 	// Format the port properly(:8080)
-	port := fmt.Sprintf(":%s", args[1])
+	port := fmt.Sprintf(":%s", flags.Arg(0))
 
-	router := NewRouter()
+	// Canceled on shutdown, event streams would never end otherwise
+	streams, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
 
-	router.HandleRoute("/health", func(w ResponseWriter, r *Request) {
+	router := httpcore.NewRouter()
+
+	router.Use(logRequests)
+
+	router.HandleRoute("GET /health", func(w httpcore.ResponseWriter, r *httpcore.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		data := ExampleBody{
@@ -36,13 +63,126 @@ func run(args []string) error {
 		json.NewEncoder(w).Encode(data)
 	})
 
-	s := Server{
-		Addr:   port,
-		router: router,
+	router.HandleRoute("POST /echo", func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		var data ExampleBody
+
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			w.WriteHeader(httpcore.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	})
+
+	router.HandleRoute("GET /events", func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		stream, err := httpcore.NewEventStream(w, r)
+		if err != nil {
+			w.WriteHeader(httpcore.StatusInternalServerError)
+			return
+		}
+
+		// End the stream when the request is done or the server
+		// shuts down, whichever comes first
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		defer context.AfterFunc(streams, cancel)()
+
+		stream.Stream(ctx, clock(ctx))
+	})
+
+	// Files under ./static, e.g. GET /static/app.js
+	router.Handle("GET /static/{path...}", httpcore.StripPrefix("/static", &httpcore.FileServer{
+		FS:              httpcore.Dir("static"),
+		ListDirectories: true,
+	}))
+
+	s := &httpcore.Server{
+		Addr:    port,
+		Handler: router,
+	}
+
+	if *useTLS && len(*certFile) == 0 {
+		cert, err := tlsutil.SelfSignedCertificate()
+		if err != nil {
+			return err
+		}
+
+		s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	s.RegisterOnShutdown(stopStreams)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		if *useTLS {
+			errc <- s.ListenAndServeTLS(*certFile, *keyFile)
+		} else {
+			errc <- s.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
 	}
 
-	return s.ListenAndServe()
+	slog.Info("shutting down")
+
+	// Let in-flight requests finish
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return s.Shutdown(ctx)
+}
+
+// logRequests logs the method, path and duration of every request
+func logRequests(next httpcore.Handler) httpcore.Handler {
+	return httpcore.HandlerFunc(func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		start := time.Now()
+
+		next.ServeHTTP(w, r)
+
+		slog.Info("request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Duration("took", time.Since(start)),
+		)
+	})
+}
+
+// clock sends the time every second until ctx is done
+func clock(ctx context.Context) <-chan httpcore.Event {
+	events := make(chan httpcore.Event)
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case t := <-ticker.C:
+				e := httpcore.Event{ID: strconv.FormatInt(t.Unix(), 10), Event: "tick", Data: t.Format(time.RFC3339)}
+
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
+	return events
 }
 
 type ExampleBody struct {
@@ -1,25 +0,0 @@
-package main
-
-const (
-	StatusOK = 200
-
-	StatusBadRequest = 400
-	StatusNotFound   = 404
-
-	StatusInternalServerError = 500
-)
-
-func StatusText(code int) string {
-	switch code {
-	case StatusOK:
-		return "OK"
-	case StatusBadRequest:
-		return "Bad Request"
-	case StatusNotFound:
-		return "Not Found"
-	case StatusInternalServerError:
-		return "Internal Server Error"
-	default:
-		return ""
-	}
-}
@@ -0,0 +1,152 @@
+package httpcore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultMaxBodyBytes is the request body limit used when
+// Server.MaxBodyBytes is not set.
+const DefaultMaxBodyBytes = 10 << 20 // 10 MiB
+
+// maxDrainBytes is how much of an unread request body the server is
+// willing to discard so the connection can be reused for the next request.
+const maxDrainBytes = 256 << 10 // 256 KiB
+
+var ErrBodyTooLarge = errors.New("request body too large")
+var ErrInvalidContentLength = errors.New("invalid Content-Length")
+var ErrBodyReadAfterClose = errors.New("read on closed request body")
+var ErrBodyNotDrained = errors.New("request body too large to drain")
+
+// NoBody is an empty request body. It is used as Request.Body
+// for requests that carry no message body, so handlers never
+// have to check for nil.
+var NoBody = noBody{}
+
+type noBody struct{}
+
+func (noBody) Read([]byte) (int, error) { return 0, io.EOF }
+func (noBody) Close() error             { return nil }
+
+// body is the Request.Body of a request that carries a message body.
+//
+// src yields exactly the bytes of the body and then io.EOF, so
+// whatever follows on the wire (the next request) stays in the
+// connection's Reader.
+type body struct {
+	src io.Reader
+
+	sawEOF bool
+	closed bool
+}
+
+func (b *body) Read(p []byte) (n int, err error) {
+	if b.closed {
+		return 0, ErrBodyReadAfterClose
+	}
+
+	if b.sawEOF {
+		return 0, io.EOF
+	}
+
+	n, err = b.src.Read(p)
+
+	if err == io.EOF {
+		b.sawEOF = true
+	}
+
+	return n, readBodyError(err)
+}
+
+// readBodyError tells a body read that hit the read deadline apart
+// from other failures.
+func readBodyError(err error) error {
+	if isTimeout(err) {
+		return fmt.Errorf("%w: %w", ErrReadBodyTimeout, err)
+	}
+
+	return err
+}
+
+// Close discards the part of the body the handler did not read.
+//
+// Bodies with more than maxDrainBytes left are not drained and
+// ErrBodyNotDrained is returned; the connection must not be reused.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.sawEOF {
+		return nil
+	}
+
+	n, err := io.CopyN(io.Discard, b.src, maxDrainBytes+1)
+
+	switch {
+	case err == io.EOF:
+		return nil
+	case err != nil:
+		return readBodyError(err)
+	case n > maxDrainBytes:
+		return ErrBodyNotDrained
+	default:
+		return nil
+	}
+}
+
+// fixedLengthReader reads exactly n bytes of a Content-Length body.
+type fixedLengthReader struct {
+	r io.Reader
+	n int64 // bytes left
+}
+
+func (fr *fixedLengthReader) Read(p []byte) (n int, err error) {
+	if fr.n <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > fr.n {
+		p = p[:fr.n]
+	}
+
+	n, err = fr.r.Read(p)
+	fr.n -= int64(n)
+
+	// The connection ended before Content-Length bytes arrived
+	if err == io.EOF && fr.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err == nil && fr.n == 0 {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// parseContentLength parses the value of a Content-Length header.
+//
+// Content-Length = 1*DIGIT (RFC 7230, section 3.3.2). Signs and
+// whitespace inside the value are rejected.
+func parseContentLength(v string) (int64, error) {
+	if len(v) == 0 {
+		return 0, ErrInvalidContentLength
+	}
+
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return 0, ErrInvalidContentLength
+		}
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidContentLength
+	}
+
+	return n, nil
+}
@@ -0,0 +1,217 @@
+package httpcore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Chunked transfer coding (RFC 7230, section 4.1)
+//
+// chunked-body   = *chunk
+//                  last-chunk
+//                  trailer-part
+//                  CRLF
+//
+// chunk          = chunk-size [ chunk-ext ] CRLF
+//                  chunk-data CRLF
+// chunk-size     = 1*HEXDIG
+// last-chunk     = 1*("0") [ chunk-ext ] CRLF
+
+var ErrMalformedChunkedEncoding = errors.New("malformed chunked encoding")
+var ErrUnsupportedTransferEncoding = errors.New("unsupported transfer encoding")
+
+// chunkedReader decodes a chunked request body.
+//
+// Chunk extensions are ignored. Trailer fields are parsed into
+// trailer once the last chunk has been read, within the same limits
+// as the request's header section.
+type chunkedReader struct {
+	r      *Reader
+	limits requestLimits
+
+	n        uint64 // bytes left in the current chunk
+	read     int64  // total body bytes read so far
+	checkEnd bool   // chunk data read, CRLF still pending
+
+	trailer Header
+
+	err error
+}
+
+func newChunkedReader(r *Reader, limits requestLimits, trailer Header) *chunkedReader {
+	return &chunkedReader{
+		r:       r,
+		limits:  limits,
+		trailer: trailer,
+	}
+}
+
+func (cr *chunkedReader) Read(p []byte) (n int, err error) {
+	for cr.err == nil && cr.n == 0 {
+		if cr.checkEnd {
+			cr.err = cr.readChunkEnd()
+			cr.checkEnd = false
+
+			continue
+		}
+
+		cr.err = cr.beginChunk()
+	}
+
+	if cr.err != nil {
+		return 0, cr.err
+	}
+
+	if uint64(len(p)) > cr.n {
+		p = p[:cr.n]
+	}
+
+	n, err = cr.r.Read(p)
+
+	cr.n -= uint64(n)
+	cr.read += int64(n)
+
+	if cr.n == 0 {
+		cr.checkEnd = true
+	}
+
+	if err == io.EOF {
+		// The connection ended in the middle of a chunk
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		cr.err = err
+	}
+
+	return n, err
+}
+
+// beginChunk reads the chunk-size line of the next chunk.
+//
+// On the last chunk it also reads the trailer section and
+// reports io.EOF.
+func (cr *chunkedReader) beginChunk() error {
+	line, err := cr.r.ReadLine()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	size, err := parseChunkSize(line)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		return cr.readTrailer()
+	}
+
+	if cr.read+int64(size) > cr.limits.maxBodyBytes || int64(size) < 0 {
+		return ErrBodyTooLarge
+	}
+
+	cr.n = size
+
+	return nil
+}
+
+// readChunkEnd consumes the CRLF that follows chunk-data
+func (cr *chunkedReader) readChunkEnd() error {
+	line, err := cr.r.ReadLine()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	if len(line) != 0 {
+		return ErrMalformedChunkedEncoding
+	}
+
+	return nil
+}
+
+// readTrailer reads the trailer-part and the final CRLF.
+func (cr *chunkedReader) readTrailer() error {
+	h, err := parseHeaders(cr.r, cr.limits.maxHeaderBytes, cr.limits.maxHeaderFields)
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	for k, v := range h {
+		// Framing fields can't be sent in a trailer (RFC 7230, section 4.1.2)
+		switch k {
+		case "Content-Length", "Transfer-Encoding", "Host", "Trailer":
+			continue
+		}
+
+		if cr.trailer != nil {
+			cr.trailer[k] = v
+		}
+	}
+
+	return io.EOF
+}
+
+// parseChunkSize parses the chunk-size from a chunk-size line,
+// skipping any chunk extensions.
+func parseChunkSize(line string) (uint64, error) {
+	// chunk-ext = *( ";" chunk-ext-name [ "=" chunk-ext-val ] )
+	size, _, _ := strings.Cut(line, ";")
+	size = strings.TrimRight(size, " \t")
+
+	if len(size) == 0 || len(size) > 16 {
+		return 0, ErrMalformedChunkedEncoding
+	}
+
+	n, err := strconv.ParseUint(size, 16, 64)
+	if err != nil {
+		return 0, ErrMalformedChunkedEncoding
+	}
+
+	return n, nil
+}
+
+// writeChunk writes p to w as a single chunk.
+//
+// An empty p is skipped since a zero-sized chunk marks the end
+// of the body.
+func writeChunk(w *bufio.Writer, p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	if _, err := w.WriteString(strconv.FormatInt(int64(len(p)), 16)); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(CRLF); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(p); err != nil {
+		return err
+	}
+
+	_, err := w.Write(CRLF)
+
+	return err
+}
+
+// writeLastChunk ends a chunked body with the last-chunk and an
+// empty trailer section.
+func writeLastChunk(w *bufio.Writer) error {
+	_, err := w.WriteString("0\r\n\r\n")
+
+	return err
+}
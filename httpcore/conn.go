@@ -0,0 +1,326 @@
+package httpcore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultIdleTimeout is how long a keep-alive connection may wait
+// for its next request when Server.IdleTimeout is not set.
+const DefaultIdleTimeout = 60 * time.Second
+
+// DefaultReadHeaderTimeout is how long a client may take to send
+// the request headers when neither Server.ReadHeaderTimeout nor
+// Server.ReadTimeout is set.
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+var ErrReadHeaderTimeout = errors.New("timeout reading request headers")
+var ErrReadBodyTimeout = errors.New("timeout reading request body")
+var ErrWriteTimeout = errors.New("timeout writing response")
+
+// conn is the server side of one client connection.
+//
+// The Reader and the bufio.Writer live as long as the connection,
+// so bytes of a pipelined request that were buffered while reading
+// the previous one are not lost.
+type conn struct {
+	server *Server
+
+	rwc net.Conn
+
+	r *Reader
+
+	bufw *bufio.Writer
+
+	requests int // requests read on this connection
+
+	readStart time.Time // first byte of the current request arrived
+
+	handler Handler // server's handler wrapped by its middlewares
+
+	hijacked bool // a handler took the connection over
+
+	idle atomic.Bool // waiting for the next request, safe to close on shutdown
+}
+
+func (s *Server) newConn(rwc net.Conn) *conn {
+	c := &conn{
+		server: s,
+		rwc:    rwc,
+		r:      NewReader(rwc),
+		bufw:   bufio.NewWriter(rwc),
+
+		handler: s.handler(),
+	}
+	c.idle.Store(true)
+
+	return c
+}
+
+// serve reads and answers requests until the client or the
+// server decides to close the connection.
+func (c *conn) serve() {
+	defer func() {
+		if !c.hijacked {
+			c.rwc.Close()
+			c.server.trackConn(c, false)
+		}
+	}()
+
+	for {
+		if !c.waitForRequest() {
+			return
+		}
+
+		// Parse the HTTP request
+		res, err := c.readRequest()
+
+		if err != nil {
+			if res != nil {
+				c.writeRequestError(res, err)
+			}
+
+			// Drop the connection
+			return
+		}
+
+		c.requests++
+		res.wantKeepAlive = c.shouldKeepAlive(res.req)
+
+		if !c.handleRequest(res) {
+			return
+		}
+
+		// Discard any body the handler left unread
+		if err := res.req.Body.Close(); err != nil {
+			slog.Error("could not discard request body", slog.String("err", err.Error()))
+
+			return
+		}
+
+		if res.closeAfterReply {
+			return
+		}
+	}
+}
+
+// handleRequest runs the handler and sends its response.
+//
+// A panic in the handler (or while sending the response) only ends
+// this request: it is logged with its stack and answered with a
+// 500 if nothing was sent yet. Either way the connection is closed,
+// since a half-sent response can't be recovered.
+//
+// It reports false if the connection must be closed.
+func (c *conn) handleRequest(res *response) (ok bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res.req.ctx = ctx
+	res.cancel = cancel
+
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		ok = false
+
+		req := res.req
+		if c.hijacked {
+			// The connection is no longer ours to answer on
+			slog.Error("panic serving hijacked connection",
+				slog.String("Addr", c.rwc.RemoteAddr().String()),
+				slog.Any("panic", v),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			return
+		}
+
+		slog.Error("panic serving request",
+			slog.String("Addr", c.rwc.RemoteAddr().String()),
+			slog.String("request", req.Method+" "+req.RequestURI+" "+req.Protocol),
+			slog.Any("panic", v),
+			slog.String("stack", string(debug.Stack())),
+		)
+
+		if res.headerSent {
+			// Part of the response is on its way, closing the
+			// connection is the only way to tell the client
+			return
+		}
+
+		res.reset()
+		res.wantKeepAlive = false
+		res.SetInternalServerErrHeader()
+		res.finalizeResponse()
+	}()
+
+	c.handler.ServeHTTP(res, res.req)
+
+	if c.hijacked {
+		return false
+	}
+
+	// Shutdown started while the handler ran
+	if c.server.shuttingDown() {
+		res.wantKeepAlive = false
+	}
+
+	res.finalizeResponse()
+
+	return true
+}
+
+// hijack hands the connection over to a handler.
+func (c *conn) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if c.hijacked {
+		return nil, nil, ErrHijacked
+	}
+
+	c.hijacked = true
+
+	// The server no longer closes it on shutdown
+	c.server.trackConn(c, false)
+
+	// Deadlines set by the server don't apply to the new owner
+	c.rwc.SetDeadline(time.Time{})
+
+	return c.rwc, bufio.NewReadWriter(c.r.reader, c.bufw), nil
+}
+
+// waitForRequest waits, up to the idle timeout, for the first
+// byte of the next request. The request line and headers then have
+// to arrive within the read header timeout.
+//
+// It reports false if the client closed the connection or stayed
+// idle for too long.
+func (c *conn) waitForRequest() bool {
+	if c.server.shuttingDown() {
+		return false
+	}
+
+	c.idle.Store(true)
+	defer c.idle.Store(false)
+
+	c.rwc.SetReadDeadline(time.Now().Add(c.server.idleTimeout()))
+
+	if _, err := c.r.reader.Peek(1); err != nil {
+		if isTimeout(err) {
+			slog.Info("closing idle connection", slog.String("Addr", c.rwc.RemoteAddr().String()))
+		}
+
+		return false
+	}
+
+	c.readStart = time.Now()
+	c.rwc.SetReadDeadline(c.readStart.Add(c.server.readHeaderTimeout()))
+
+	return true
+}
+
+// setRequestDeadlines replaces the read header deadline once the
+// headers are read: the body must arrive within the read timeout and
+// the response must be written within the write timeout.
+func (c *conn) setRequestDeadlines() {
+	var read, write time.Time
+
+	if t := c.server.ReadTimeout; t > 0 {
+		read = c.readStart.Add(t)
+	}
+
+	if t := c.server.WriteTimeout; t > 0 {
+		write = time.Now().Add(t)
+	}
+
+	c.rwc.SetReadDeadline(read)
+	c.rwc.SetWriteDeadline(write)
+}
+
+// isTimeout reports whether err is a deadline being exceeded.
+func isTimeout(err error) bool {
+	var ne net.Error
+
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// shouldKeepAlive reports whether the connection can be reused
+// after answering req (RFC 7230, section 6.3).
+//
+// HTTP/1.1 connections persist unless the client sends
+// "Connection: close". HTTP/1.0 connections only persist if the
+// client asks for it with "Connection: keep-alive".
+func (c *conn) shouldKeepAlive(req *Request) bool {
+	if max := c.server.MaxRequestsPerConn; max > 0 && c.requests >= max {
+		return false
+	}
+
+	// Tell the client not to send more requests on this connection
+	if c.server.shuttingDown() {
+		return false
+	}
+
+	if req.Header.HasToken("Connection", "close") {
+		return false
+	}
+
+	if req.ProtocolAtLeast(1, 1) {
+		return true
+	}
+
+	return req.Header.HasToken("Connection", "keep-alive")
+}
+
+// writeRequestError answers a request that could not be parsed.
+//
+// I/O errors are not answered since the client is most likely gone.
+func (c *conn) writeRequestError(res *response, err error) {
+	if errors.Is(err, ErrReadHeaderTimeout) {
+		slog.Error(err.Error(), slog.String("Addr", c.rwc.RemoteAddr().String()))
+
+		res.WriteHeader(StatusRequestTimeout)
+		res.finalizeResponse()
+
+		return
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return
+	}
+
+	slog.Error(err.Error())
+
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		res.WriteHeader(StatusRequestEntityTooLarge)
+
+	case errors.Is(err, ErrRequestLineTooLong):
+		res.WriteHeader(StatusRequestURITooLong)
+
+	case errors.Is(err, ErrHeaderTooLarge):
+		res.WriteHeader(StatusRequestHeaderFieldsTooLarge)
+
+	case errors.Is(err, ErrUnsupportedTransferEncoding) || errors.Is(err, ErrMethodNotImplemented):
+		res.WriteHeader(StatusNotImplemented)
+
+	default:
+		// Anything else is a malformed request
+		res.SetBadRequestHeader()
+	}
+
+	res.finalizeResponse()
+}
@@ -0,0 +1,321 @@
+package httpcore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTestConn serves s on one end of an in-memory conn and
+// returns the client end.
+func serveTestConn(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	go s.newConn(server).serve()
+
+	return client
+}
+
+// readTestResponse reads one Content-Length framed response and
+// returns its header section and body.
+func readTestResponse(t *testing.T, br *bufio.Reader) (head string, body string) {
+	t.Helper()
+
+	var sb strings.Builder
+	length := 0
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading response: %s", err)
+		}
+
+		if line == "\r\n" {
+			break
+		}
+
+		sb.WriteString(line)
+
+		if v, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			n, err := parseContentLength(strings.TrimSpace(v))
+			if err != nil {
+				t.Fatalf("bad Content-Length %q", v)
+			}
+			length = int(n)
+		}
+	}
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(br, b); err != nil {
+		t.Fatalf("reading response body: %s", err)
+	}
+
+	return sb.String(), string(b)
+}
+
+func newTestServer() *Server {
+	router := NewRouter()
+	router.HandleRoute("/health", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("OK"))
+	})
+
+	return &Server{Handler: router}
+}
+
+func TestKeepAliveServesPipelinedRequests(t *testing.T) {
+	client := serveTestConn(t, newTestServer())
+
+	go io.WriteString(client,
+		"GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+			"GET /health HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+
+	br := bufio.NewReader(client)
+
+	head, body := readTestResponse(t, br)
+	if strings.Contains(head, "Connection: close") || body != "OK" {
+		t.Fatalf("Expected a persistent 200 response, got %q %q", head, body)
+	}
+
+	head, body = readTestResponse(t, br)
+	if !strings.Contains(head, "Connection: close") || body != "OK" {
+		t.Fatalf("Expected the last response to close the connection, got %q %q", head, body)
+	}
+
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected the server to close the connection, got %v", err)
+	}
+}
+
+func TestKeepAliveHTTP10(t *testing.T) {
+	client := serveTestConn(t, newTestServer())
+
+	go io.WriteString(client,
+		"GET /health HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"+
+			"GET /health HTTP/1.0\r\n\r\n")
+
+	br := bufio.NewReader(client)
+
+	head, _ := readTestResponse(t, br)
+	if !strings.Contains(head, "Connection: keep-alive") {
+		t.Fatalf("Expected Connection: keep-alive, got %q", head)
+	}
+
+	head, _ = readTestResponse(t, br)
+	if !strings.Contains(head, "Connection: close") {
+		t.Fatalf("Expected Connection: close, got %q", head)
+	}
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	s := newTestServer()
+	s.MaxRequestsPerConn = 1
+
+	client := serveTestConn(t, s)
+
+	go io.WriteString(client, "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	head, _ := readTestResponse(t, bufio.NewReader(client))
+	if !strings.Contains(head, "Connection: close") {
+		t.Fatalf("Expected Connection: close after MaxRequestsPerConn, got %q", head)
+	}
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	s := newTestServer()
+	s.ReadHeaderTimeout = 50 * time.Millisecond
+
+	client := serveTestConn(t, s)
+
+	// A slowloris client: the headers never end
+	io.WriteString(client, "GET /health HTTP/1.1\r\nHost: loc")
+
+	br := bufio.NewReader(client)
+
+	head, _ := readTestResponse(t, br)
+	if !strings.HasPrefix(head, "HTTP/1.1 408 Request Timeout\r\n") || !strings.Contains(head, "Connection: close") {
+		t.Fatalf("Expected 408 closing the connection, got %q", head)
+	}
+
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected the server to close the connection, got %v", err)
+	}
+}
+
+func TestOversizedRequestHeads(t *testing.T) {
+	for raw, status := range map[string]string{
+		"GET /" + strings.Repeat("a", 128) + " HTTP/1.1\r\n":                               "414 URI Too Long",
+		"GET / HTTP/1.1\r\nHost: localhost\r\nX-Big: " + strings.Repeat("a", 128) + "\r\n": "431 Request Header Fields Too Large",
+	} {
+		s := newTestServer()
+		s.MaxHeaderBytes = 100
+
+		client := serveTestConn(t, s)
+		go io.WriteString(client, raw)
+
+		head, _ := readTestResponse(t, bufio.NewReader(client))
+		if !strings.HasPrefix(head, "HTTP/1.1 "+status+"\r\n") {
+			t.Errorf("Expected %s, got %q", status, head)
+		}
+	}
+}
+
+func TestReadTimeoutBody(t *testing.T) {
+	bodyErr := make(chan error, 1)
+
+	router := NewRouter()
+	router.HandleRoute("POST /upload", func(w ResponseWriter, r *Request) {
+		_, err := io.ReadAll(r.Body)
+		bodyErr <- err
+	})
+
+	s := &Server{Handler: router, ReadTimeout: 50 * time.Millisecond}
+	client := serveTestConn(t, s)
+
+	// Only part of the declared body is ever sent
+	go io.WriteString(client, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nabc")
+	go io.Copy(io.Discard, client)
+
+	select {
+	case err := <-bodyErr:
+		if !errors.Is(err, ErrReadBodyTimeout) {
+			t.Errorf("Expected ErrReadBodyTimeout, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("body read did not time out")
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	writeErr := make(chan error, 1)
+
+	router := NewRouter()
+	router.HandleRoute("/big", func(w ResponseWriter, r *Request) {
+		w.Write(make([]byte, 64<<10))
+		writeErr <- w.(Flusher).Flush()
+	})
+
+	s := &Server{Handler: router, WriteTimeout: 50 * time.Millisecond}
+	client := serveTestConn(t, s)
+
+	// The client never reads the response
+	io.WriteString(client, "GET /big HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	select {
+	case err := <-writeErr:
+		if !errors.Is(err, ErrWriteTimeout) {
+			t.Errorf("Expected ErrWriteTimeout, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write did not time out")
+	}
+}
+
+func TestHandlerPanicSends500(t *testing.T) {
+	router := NewRouter()
+	router.HandleRoute("/panic", func(w ResponseWriter, r *Request) {
+		w.Header().Set("X-Partial", "yes")
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	client := serveTestConn(t, &Server{Handler: router})
+
+	go io.WriteString(client, "GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	br := bufio.NewReader(client)
+
+	head, body := readTestResponse(t, br)
+	if !strings.HasPrefix(head, "HTTP/1.1 500 ") || !strings.Contains(head, "Connection: close") {
+		t.Fatalf("Expected a 500 closing the connection, got %q", head)
+	}
+
+	if strings.Contains(head, "X-Partial") || body != "" {
+		t.Fatalf("Expected the handler's output to be dropped, got %q %q", head, body)
+	}
+
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected the server to close the connection, got %v", err)
+	}
+}
+
+func TestHandlerPanicAfterHeadersClosesConn(t *testing.T) {
+	router := NewRouter()
+	router.HandleRoute("/panic", func(w ResponseWriter, r *Request) {
+		w.Write([]byte(strings.Repeat("a", 2*bufferBeforeChunkingSize)))
+		panic("boom")
+	})
+
+	client := serveTestConn(t, &Server{Handler: router})
+
+	go io.WriteString(client, "GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	b, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("reading response: %s", err)
+	}
+
+	// The response is cut short: no 500 and no last chunk
+	if !strings.HasPrefix(string(b), "HTTP/1.1 200 ") || strings.HasSuffix(string(b), "0\r\n\r\n") {
+		t.Fatalf("Expected a truncated 200 response, got %q", b)
+	}
+}
+
+func TestHijackKeepsBufferedBytes(t *testing.T) {
+	router := NewRouter()
+	router.HandleRoute("GET /echo", func(w ResponseWriter, r *Request) {
+		rwc, brw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %s", err)
+			return
+		}
+		defer rwc.Close()
+
+		if _, err := w.Write([]byte("too late")); err != ErrHijacked {
+			t.Errorf("Expected ErrHijacked after Hijack, got %v", err)
+		}
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+
+		// The client sent its first message along with the request
+		line, err := brw.ReadString('\n')
+		if err != nil {
+			t.Errorf("reading from hijacked conn: %s", err)
+			return
+		}
+
+		brw.WriteString("echo: " + line)
+		brw.Flush()
+	})
+
+	client := serveTestConn(t, &Server{Handler: router})
+
+	go io.WriteString(client, "GET /echo HTTP/1.1\r\nHost: localhost\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\nhello\n")
+
+	b, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("reading response: %s", err)
+	}
+
+	want := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\necho: hello\n"
+	if string(b) != want {
+		t.Fatalf("Expected %q, got %q", want, b)
+	}
+}
+
+func TestHijackNotSupportedByNewResponse(t *testing.T) {
+	res := NewResponse(io.Discard, nil)
+
+	if _, _, err := res.Hijack(); err != ErrNotHijackable {
+		t.Fatalf("Expected ErrNotHijackable, got %v", err)
+	}
+}
@@ -0,0 +1,439 @@
+package httpcore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// indexPage is served for a directory that contains it.
+const indexPage = "index.html"
+
+// FileServer is a Handler serving the files of FS, looked up by the
+// request path.
+//
+//	router.Handle("GET /static/{path...}", StripPrefix("/static", &FileServer{FS: Dir("public")}))
+//
+// It answers conditional requests (If-None-Match, If-Modified-Since)
+// with 304 Not Modified and Range requests with 206 Partial Content,
+// as multipart/byteranges when several ranges are asked for.
+//
+// A directory is served through its index.html. Paths to directories
+// must end with a slash and paths to files must not; other requests
+// are redirected.
+type FileServer struct {
+	FS fs.FS
+
+	// ListDirectories serves an HTML listing of directories without
+	// an index.html. Otherwise they are answered with 403 Forbidden.
+	ListDirectories bool
+}
+
+// Dir returns the file system of the files under the directory dir.
+func Dir(dir string) fs.FS {
+	return os.DirFS(dir)
+}
+
+func (f *FileServer) ServeHTTP(w ResponseWriter, r *Request) {
+	if r.Method != MethodGet && r.Method != MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(r.URL.Path, "/")
+	if len(name) == 0 {
+		name = "."
+	}
+
+	if !fs.ValidPath(name) {
+		w.WriteHeader(StatusNotFound)
+		return
+	}
+
+	file, err := f.FS.Open(name)
+	if err != nil {
+		serveFileError(w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		serveFileError(w, err)
+		return
+	}
+
+	trailingSlash := strings.HasSuffix(r.URL.Path, "/")
+
+	if !info.IsDir() {
+		if trailingSlash {
+			redirect(w, r, "../"+escapeSegment(path.Base(r.URL.Path)))
+			return
+		}
+
+		serveContent(w, r, info, file)
+		return
+	}
+
+	if !trailingSlash {
+		redirect(w, r, escapeSegment(path.Base(r.URL.Path))+"/")
+		return
+	}
+
+	if index, err := f.FS.Open(path.Join(name, indexPage)); err == nil {
+		defer index.Close()
+
+		if info, err := index.Stat(); err == nil && !info.IsDir() {
+			serveContent(w, r, info, index)
+			return
+		}
+	}
+
+	if !f.ListDirectories {
+		w.WriteHeader(StatusForbidden)
+		return
+	}
+
+	f.listDirectory(w, r, name)
+}
+
+// StripPrefix returns a handler that serves requests by removing
+// prefix from the request path and calling h.
+//
+// Requests whose path doesn't start with prefix get 404 Not Found.
+func StripPrefix(prefix string, h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		p, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			NotFound(w, r)
+			return
+		}
+
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+
+		u := *r.URL
+		u.Path = p
+
+		r2 := *r
+		r2.URL = &u
+
+		h.ServeHTTP(w, &r2)
+	})
+}
+
+// serveFileError answers a failed lookup in the file system.
+func serveFileError(w ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		w.WriteHeader(StatusNotFound)
+
+	case errors.Is(err, fs.ErrPermission):
+		w.WriteHeader(StatusForbidden)
+
+	default:
+		slog.Error("could not open file", slog.String("err", err.Error()))
+		w.WriteHeader(StatusInternalServerError)
+	}
+}
+
+// redirect replies 301 Moved Permanently to location, relative to
+// the request path. The query is kept.
+func redirect(w ResponseWriter, r *Request, location string) {
+	if len(r.URL.RawQuery) > 0 {
+		location += "?" + r.URL.RawQuery
+	}
+
+	w.Header().Set("Location", location)
+	w.WriteHeader(StatusMovedPermanently)
+}
+
+// listDirectory writes an HTML page linking to the entries of the
+// directory name.
+func (f *FileServer) listDirectory(w ResponseWriter, r *Request, name string) {
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		serveFileError(w, err)
+		return
+	}
+
+	title := html.EscapeString("Index of " + r.URL.Path)
+
+	var sb strings.Builder
+
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	sb.WriteString("<title>" + title + "</title>\n</head>\n<body>\n")
+	sb.WriteString("<h1>" + title + "</h1>\n<ul>\n")
+
+	if name != "." {
+		sb.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+
+	// fs.ReadDir sorts the entries by name
+	for _, e := range entries {
+		entry := e.Name()
+		if e.IsDir() {
+			entry += "/"
+		}
+
+		href := escapeSegment(e.Name())
+		if e.IsDir() {
+			href += "/"
+		}
+
+		sb.WriteString("<li><a href=\"" + html.EscapeString(href) + "\">" + html.EscapeString(entry) + "</a></li>\n")
+	}
+
+	sb.WriteString("</ul>\n</body>\n</html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(sb.String()))
+}
+
+// serveContent sends the content of file, described by info.
+//
+// Content-Type comes from the file extension, or is sniffed from
+// the content. Ranges are only served for files that can seek.
+func serveContent(w ResponseWriter, r *Request, info fs.FileInfo, file fs.File) {
+	modtime := info.ModTime()
+
+	// Files without a modification time (e.g. embed.FS) get no
+	// validators, since their content could change at the same size
+	var etag string
+	if !modtime.IsZero() {
+		etag = fmt.Sprintf("\"%x-%x\"", modtime.UnixNano(), info.Size())
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", modtime.UTC().Format(TimeFormat))
+	}
+
+	if notModified(r, etag, modtime) {
+		w.WriteHeader(StatusNotModified)
+		return
+	}
+
+	seeker, seekable := file.(io.Seeker)
+
+	var content io.Reader = file
+
+	ctype := mime.TypeByExtension(path.Ext(info.Name()))
+	if len(ctype) == 0 {
+		buf := make([]byte, sniffLen)
+
+		n, err := io.ReadFull(file, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			serveFileError(w, err)
+			return
+		}
+
+		ctype = DetectContentType(buf[:n])
+
+		if seekable {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				serveFileError(w, err)
+				return
+			}
+		} else {
+			content = io.MultiReader(bytes.NewReader(buf[:n]), file)
+		}
+	}
+
+	size := info.Size()
+
+	var ranges []byteRange
+
+	if seekable {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		if rh := r.Header.Get("Range"); len(rh) > 0 && ifRangeMatches(r, etag, modtime) {
+			var err error
+
+			ranges, err = parseRange(rh, size)
+
+			if errors.Is(err, errRangeNotSatisfiable) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				w.WriteHeader(StatusRequestedRangeNotSatisfiable)
+				return
+			}
+
+			// Overlapping ranges asking for more than the whole file
+			// are answered with the whole file
+			var total int64
+			for _, ra := range ranges {
+				total += ra.length
+			}
+
+			if total > size {
+				ranges = nil
+			}
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Length", fmt.Sprint(size))
+		w.WriteHeader(StatusOK)
+
+		if r.Method != MethodHead {
+			io.CopyN(w, content, size)
+		}
+
+	case 1:
+		ra := ranges[0]
+
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Range", ra.contentRange(size))
+		w.Header().Set("Content-Length", fmt.Sprint(ra.length))
+		w.WriteHeader(StatusPartialContent)
+
+		if r.Method != MethodHead {
+			if _, err := seeker.Seek(ra.start, io.SeekStart); err == nil {
+				io.CopyN(w, content, ra.length)
+			}
+		}
+
+	default:
+		serveMultipartRanges(w, r, ctype, size, ranges, file)
+	}
+}
+
+// serveMultipartRanges sends ranges of file as a
+// multipart/byteranges body (RFC 7233, appendix A).
+func serveMultipartRanges(w ResponseWriter, r *Request, ctype string, size int64, ranges []byteRange, file fs.File) {
+	seeker := file.(io.Seeker)
+
+	// The length of the body is known beforehand: write the parts
+	// without their content to count the framing bytes
+	var counter countingWriter
+
+	mw := multipart.NewWriter(&counter)
+	for _, ra := range ranges {
+		mw.CreatePart(rangePartHeader(ctype, ra, size))
+		counter.n += ra.length
+	}
+	mw.Close()
+
+	boundary := mw.Boundary()
+
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	w.Header().Set("Content-Length", fmt.Sprint(counter.n))
+	w.WriteHeader(StatusPartialContent)
+
+	if r.Method == MethodHead {
+		return
+	}
+
+	mw = multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(rangePartHeader(ctype, ra, size))
+		if err != nil {
+			return
+		}
+
+		if _, err := seeker.Seek(ra.start, io.SeekStart); err != nil {
+			return
+		}
+
+		if _, err := io.CopyN(part, file, ra.length); err != nil {
+			return
+		}
+	}
+
+	mw.Close()
+}
+
+func rangePartHeader(ctype string, ra byteRange, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":  {ctype},
+		"Content-Range": {ra.contentRange(size)},
+	}
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+
+	return len(p), nil
+}
+
+// notModified reports whether the client's cached copy is still
+// fresh (RFC 7232, section 6): If-None-Match is checked against
+// etag, and only without it If-Modified-Since against modtime.
+func notModified(r *Request, etag string, modtime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); len(inm) > 0 {
+		return etagListMatches(inm, etag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if len(ims) == 0 || modtime.IsZero() {
+		return false
+	}
+
+	t, err := time.Parse(TimeFormat, ims)
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates have no sub-second precision
+	return !modtime.Truncate(time.Second).After(t)
+}
+
+// etagListMatches reports whether the If-None-Match list contains
+// etag or "*". Entity tags are compared weakly, ignoring "W/".
+func etagListMatches(list, etag string) bool {
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+
+		if t == "*" {
+			return true
+		}
+
+		if len(etag) > 0 && strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifRangeMatches reports whether the Range header applies: either
+// there is no If-Range, or it names the current version of the file
+// (RFC 7233, section 3.2). Entity tags are compared strongly.
+func ifRangeMatches(r *Request, etag string, modtime time.Time) bool {
+	v := r.Header.Get("If-Range")
+	if len(v) == 0 {
+		return true
+	}
+
+	if strings.HasPrefix(v, "\"") {
+		return len(etag) > 0 && v == etag
+	}
+
+	if strings.HasPrefix(v, "W/") {
+		return false
+	}
+
+	t, err := time.Parse(TimeFormat, v)
+
+	return err == nil && !modtime.IsZero() && modtime.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,216 @@
+package httpcore
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testModTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"hello.txt":       {Data: []byte("hello, world"), ModTime: testModTime},
+		"blob":            {Data: []byte("<!DOCTYPE html><p>sniffed</p>"), ModTime: testModTime},
+		"docs/index.html": {Data: []byte("<h1>docs</h1>"), ModTime: testModTime},
+		"assets/a b.css":  {Data: []byte("body{}"), ModTime: testModTime},
+	}
+}
+
+// serveTestFile sends a request through a FileServer and returns
+// the raw response.
+func serveTestFile(fs *FileServer, method, path string, header Header) string {
+	if header == nil {
+		header = make(Header)
+	}
+
+	res, out := newTestResponse(&Request{
+		Method:        method,
+		URL:           &URL{Path: path},
+		Header:        header,
+		ProtocolMajor: 1,
+		ProtocolMinor: 1,
+	})
+
+	fs.ServeHTTP(res, res.req)
+	res.finalizeResponse()
+
+	return out.String()
+}
+
+func TestFileServerServesFile(t *testing.T) {
+	got := serveTestFile(&FileServer{FS: newTestFS()}, MethodGet, "/hello.txt", nil)
+
+	for _, want := range []string{
+		"HTTP/1.1 200 OK\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"Content-Length: 12\r\n",
+		"Last-Modified: Fri, 01 Mar 2024 12:00:00 GMT\r\n",
+		"Accept-Ranges: bytes\r\n",
+		"Etag: \"",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("Expected %q in %q", want, got)
+		}
+	}
+
+	if !strings.HasSuffix(got, "\r\n\r\nhello, world") {
+		t.Fatalf("Expected the file content, got %q", got)
+	}
+}
+
+func TestFileServerSniffsContentType(t *testing.T) {
+	got := serveTestFile(&FileServer{FS: newTestFS()}, MethodGet, "/blob", nil)
+
+	if !strings.Contains(got, "Content-Type: text/html; charset=utf-8\r\n") {
+		t.Fatalf("Expected sniffed text/html, got %q", got)
+	}
+}
+
+func TestFileServerConditionalRequests(t *testing.T) {
+	fs := &FileServer{FS: newTestFS()}
+
+	got := serveTestFile(fs, MethodGet, "/hello.txt", nil)
+	etag := got[strings.Index(got, "Etag: ")+len("Etag: "):]
+	etag = etag[:strings.Index(etag, "\r\n")]
+
+	header := make(Header)
+	header.Set("If-None-Match", "\"other\", W/"+etag)
+
+	if got := serveTestFile(fs, MethodGet, "/hello.txt", header); !strings.HasPrefix(got, "HTTP/1.1 304 ") {
+		t.Fatalf("Expected 304 for a matching If-None-Match, got %q", got)
+	}
+
+	header = make(Header)
+	header.Set("If-Modified-Since", testModTime.Format(TimeFormat))
+
+	if got := serveTestFile(fs, MethodGet, "/hello.txt", header); !strings.HasPrefix(got, "HTTP/1.1 304 ") {
+		t.Fatalf("Expected 304 for an unchanged file, got %q", got)
+	}
+
+	header.Set("If-Modified-Since", testModTime.Add(-time.Hour).Format(TimeFormat))
+
+	if got := serveTestFile(fs, MethodGet, "/hello.txt", header); !strings.HasPrefix(got, "HTTP/1.1 200 ") {
+		t.Fatalf("Expected 200 for a modified file, got %q", got)
+	}
+}
+
+func TestFileServerSingleRange(t *testing.T) {
+	header := make(Header)
+	header.Set("Range", "bytes=7-")
+
+	got := serveTestFile(&FileServer{FS: newTestFS()}, MethodGet, "/hello.txt", header)
+
+	if !strings.HasPrefix(got, "HTTP/1.1 206 ") || !strings.Contains(got, "Content-Range: bytes 7-11/12\r\n") {
+		t.Fatalf("Expected a 206 for bytes 7-11, got %q", got)
+	}
+
+	if !strings.HasSuffix(got, "\r\n\r\nworld") {
+		t.Fatalf("Expected the requested range, got %q", got)
+	}
+
+	// A stale If-Range gets the whole file
+	header.Set("If-Range", "\"stale\"")
+
+	if got := serveTestFile(&FileServer{FS: newTestFS()}, MethodGet, "/hello.txt", header); !strings.HasPrefix(got, "HTTP/1.1 200 ") {
+		t.Fatalf("Expected 200 for a stale If-Range, got %q", got)
+	}
+}
+
+func TestFileServerMultipleRanges(t *testing.T) {
+	header := make(Header)
+	header.Set("Range", "bytes=0-4, -5")
+
+	got := serveTestFile(&FileServer{FS: newTestFS()}, MethodGet, "/hello.txt", header)
+
+	if !strings.HasPrefix(got, "HTTP/1.1 206 ") || !strings.Contains(got, "Content-Type: multipart/byteranges; boundary=") {
+		t.Fatalf("Expected a multipart/byteranges 206, got %q", got)
+	}
+
+	for _, want := range []string{
+		"Content-Range: bytes 0-4/12\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nhello\r\n",
+		"Content-Range: bytes 7-11/12\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nworld\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("Expected part %q in %q", want, got)
+		}
+	}
+
+	head, body, _ := strings.Cut(got, "\r\n\r\n")
+	if !strings.Contains(head+"\r\n", "Content-Length: "+strconv.Itoa(len(body))+"\r\n") {
+		t.Fatalf("Expected Content-Length %d in %q", len(body), head)
+	}
+}
+
+func TestFileServerUnsatisfiableRange(t *testing.T) {
+	header := make(Header)
+	header.Set("Range", "bytes=100-")
+
+	got := serveTestFile(&FileServer{FS: newTestFS()}, MethodGet, "/hello.txt", header)
+
+	if !strings.HasPrefix(got, "HTTP/1.1 416 ") || !strings.Contains(got, "Content-Range: bytes */12\r\n") {
+		t.Fatalf("Expected 416, got %q", got)
+	}
+}
+
+func TestFileServerDirectories(t *testing.T) {
+	fs := &FileServer{FS: newTestFS()}
+
+	if got := serveTestFile(fs, MethodGet, "/docs", nil); !strings.Contains(got, "Location: docs/\r\n") {
+		t.Fatalf("Expected a redirect to docs/, got %q", got)
+	}
+
+	if got := serveTestFile(fs, MethodGet, "/docs/", nil); !strings.HasSuffix(got, "<h1>docs</h1>") {
+		t.Fatalf("Expected the index page, got %q", got)
+	}
+
+	if got := serveTestFile(fs, MethodGet, "/assets/", nil); !strings.HasPrefix(got, "HTTP/1.1 403 ") {
+		t.Fatalf("Expected 403 without listings, got %q", got)
+	}
+
+	fs.ListDirectories = true
+
+	if got := serveTestFile(fs, MethodGet, "/assets/", nil); !strings.Contains(got, "<a href=\"a%20b.css\">a b.css</a>") {
+		t.Fatalf("Expected a listing, got %q", got)
+	}
+
+	if got := serveTestFile(fs, MethodGet, "/missing", nil); !strings.HasPrefix(got, "HTTP/1.1 404 ") {
+		t.Fatalf("Expected 404, got %q", got)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []byteRange
+		err    error
+	}{
+		{"bytes=0-499", []byteRange{{0, 500}}, nil},
+		{"bytes=500-", []byteRange{{500, 500}}, nil},
+		{"bytes=-200", []byteRange{{800, 200}}, nil},
+		{"bytes=900-2000", []byteRange{{900, 100}}, nil},
+		{"bytes=0-0, 2000-, -1", []byteRange{{0, 1}, {999, 1}}, nil},
+		{"bytes=2000-", nil, errRangeNotSatisfiable},
+		{"bytes=5-1", nil, errInvalidRange},
+		{"items=0-1", nil, errInvalidRange},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, 1000)
+		if err != tt.err {
+			t.Fatalf("%q: expected error %v, got %v", tt.header, tt.err, err)
+		}
+
+		if len(got) != len(tt.want) {
+			t.Fatalf("%q: expected %v, got %v", tt.header, tt.want, got)
+		}
+
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%q: expected %v, got %v", tt.header, tt.want, got)
+			}
+		}
+	}
+}
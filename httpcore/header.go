@@ -0,0 +1,138 @@
+package httpcore
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// It represents the key-value pairs in an HTTP header
+type Header map[string][]string
+
+// Adds key, value pair to header
+//
+// The key is case-insensitive
+func (h Header) Add(key, value string) {
+
+	// Convert key to canonicalMIMEHeaderKey
+	kl := textproto.CanonicalMIMEHeaderKey(key)
+	if _, ok := h[kl]; !ok {
+		h[kl] = make([]string, 0)
+	}
+
+	// Append the value at the given key
+	h[kl] = append(h[kl], value)
+}
+
+// Sets key to the new value
+func (h Header) Set(key, value string) {
+
+	kl := textproto.CanonicalMIMEHeaderKey(key)
+
+	// Delete any previous entry
+	delete(h, kl)
+
+	h[kl] = []string{value}
+}
+
+// Get returns the first value associated with the given key
+//
+// If no value for a key, it returns empty string
+func (h Header) Get(key string) string {
+	kl := textproto.CanonicalMIMEHeaderKey(key)
+
+	if _, ok := h[kl]; !ok {
+		return ""
+	}
+
+	return h[kl][0]
+}
+
+// Values returns all the values associated with the given key.
+//
+// It is case insensitive
+func (h Header) Values(key string) []string {
+	kl := textproto.CanonicalMIMEHeaderKey(key)
+
+	if h == nil {
+		return nil
+	}
+
+	return h[kl]
+}
+
+// Del deletes the values associated with the key
+func (h Header) Del(key string) {
+	delete(h, textproto.CanonicalMIMEHeaderKey(key))
+}
+
+// HasToken reports whether any of the comma-separated values of key
+// contains token. Tokens are compared case-insensitively.
+//
+// It is meant for list-valued fields such as Connection, where
+// "Connection: keep-alive, Upgrade" contains the token "upgrade".
+func (h Header) HasToken(key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// validHeaderFieldName reports whether k may be used as a field name
+// (RFC 7230, section 3.2).
+//
+// field-name = token
+func validHeaderFieldName(k string) bool {
+	return isToken(k)
+}
+
+// validHeaderFieldValue reports whether v may be sent as a field
+// value (RFC 7230, section 3.2). Control characters other than HTAB,
+// CR and LF in particular, are not allowed: they would let a value
+// end the field (or the whole header section) early.
+//
+// field-value   = *( field-content / obs-fold )
+// field-content = field-vchar [ 1*( SP / HTAB ) field-vchar ]
+// field-vchar   = VCHAR / obs-text
+func validHeaderFieldValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isToken reports whether s is a non-empty token (RFC 7230, section 3.2.6)
+//
+// token = 1*tchar
+func isToken(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if !isTchar(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tchar = "!" / "#" / "$" / "%" / "&" / "'" / "*" / "+" / "-" / "." /
+//
+//	"^" / "_" / "`" / "|" / "~" / DIGIT / ALPHA
+func isTchar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+	}
+}
@@ -0,0 +1,31 @@
+package httpcore
+
+// Common HTTP methods.
+//
+// Unless otherwise noted, these are defined in RFC 7231 section 4.3.
+
+const (
+	MethodGet     = "GET"
+	MethodHead    = "HEAD"
+	MethodPost    = "POST"
+	MethodPut     = "PUT"
+	MethodPatch   = "PATCH" // RFC 5789
+	MethodDelete  = "DELETE"
+	MethodConnect = "CONNECT"
+	MethodOptions = "OPTIONS"
+	MethodTrace   = "TRACE"
+)
+
+// knownMethod reports whether m is one of the methods above.
+//
+// Other syntactically valid methods are answered with
+// 501 Not Implemented (RFC 7231, section 4.1).
+func knownMethod(m string) bool {
+	switch m {
+	case MethodGet, MethodHead, MethodPost, MethodPut, MethodPatch,
+		MethodDelete, MethodConnect, MethodOptions, MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
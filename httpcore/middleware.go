@@ -0,0 +1,28 @@
+package httpcore
+
+// Middleware wraps a Handler with cross-cutting behavior (logging,
+// auth, CORS, ...).
+//
+// A middleware calls next.ServeHTTP to continue down the chain, or
+// writes a response itself and returns to short-circuit it:
+//
+//	func RequireToken(next Handler) Handler {
+//		return HandlerFunc(func(w ResponseWriter, r *Request) {
+//			if r.Header.Get("Authorization") == "" {
+//				w.WriteHeader(StatusUnauthorized)
+//				return
+//			}
+//			next.ServeHTTP(w, r)
+//		})
+//	}
+type Middleware func(next Handler) Handler
+
+// Chain wraps h with the middlewares. The first middleware is the
+// outermost one, so it sees the request first and the response last.
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,75 @@
+package httpcore
+
+import (
+	"testing"
+)
+
+// tag returns a middleware that records name before and after
+// calling the next handler.
+func tag(name string, trace *[]string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, r)
+			*trace = append(*trace, "/"+name)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+
+	router := NewRouter()
+	router.Use(tag("a", &trace), tag("b", &trace))
+	router.HandleRoute("GET /", func(w ResponseWriter, r *Request) {
+		trace = append(trace, "handler")
+	})
+
+	routeTestRequest(router, MethodGet, "/")
+
+	want := []string{"a", "b", "handler", "/b", "/a"}
+	if len(trace) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, trace)
+	}
+
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, trace)
+		}
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	called := false
+
+	router := NewRouter()
+	router.Use(func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			if len(r.Header.Get("Authorization")) == 0 {
+				w.WriteHeader(StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.HandleRoute("GET /", func(w ResponseWriter, r *Request) { called = true })
+
+	res := routeTestRequest(router, MethodGet, "/")
+
+	if called || res.status != StatusUnauthorized {
+		t.Fatalf("Expected the middleware to answer 401, got %d (handler called: %v)", res.status, called)
+	}
+}
+
+func TestMiddlewareSeesNotFound(t *testing.T) {
+	var trace []string
+
+	router := NewRouter()
+	router.Use(tag("log", &trace))
+
+	res := routeTestRequest(router, MethodGet, "/missing")
+
+	if res.status != StatusNotFound || len(trace) != 2 {
+		t.Fatalf("Expected the middleware to wrap the 404, got %d %v", res.status, trace)
+	}
+}
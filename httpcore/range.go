@@ -0,0 +1,103 @@
+package httpcore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errInvalidRange = errors.New("invalid Range header")
+var errRangeNotSatisfiable = errors.New("no range overlaps the content")
+
+// byteRange is one range of a Range header, resolved against the
+// size of the content.
+type byteRange struct {
+	start, length int64
+}
+
+// contentRange formats the Content-Range of r (RFC 7233, section 4.2).
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header (RFC 7233, section 2.1) for
+// content of size bytes.
+//
+//	bytes=0-499        the first 500 bytes
+//	bytes=500-         everything from byte 500
+//	bytes=-500         the last 500 bytes
+//	bytes=0-0,-1       the first and the last byte
+//
+// Ranges reaching past the end are cut at the end. Ranges starting
+// past the end are dropped, and errRangeNotSatisfiable is returned
+// if none is left. A malformed header gives errInvalidRange and
+// should be ignored.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(s, "bytes=")
+	if !ok {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	skipped := false
+
+	for _, ra := range strings.Split(spec, ",") {
+		ra = strings.TrimSpace(ra)
+		if len(ra) == 0 {
+			continue
+		}
+
+		first, last, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+
+		if len(first) == 0 {
+			// suffix-byte-range-spec = "-" suffix-length
+			n, err := parseContentLength(last)
+			if err != nil {
+				return nil, errInvalidRange
+			}
+
+			r = byteRange{start: size - min(n, size), length: min(n, size)}
+		} else {
+			start, err := parseContentLength(first)
+			if err != nil {
+				return nil, errInvalidRange
+			}
+
+			end := size - 1
+
+			if len(last) > 0 {
+				if end, err = parseContentLength(last); err != nil || end < start {
+					return nil, errInvalidRange
+				}
+
+				end = min(end, size-1)
+			}
+
+			r = byteRange{start: start, length: end - start + 1}
+		}
+
+		if r.start >= size || r.length <= 0 {
+			skipped = true
+			continue
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		if skipped {
+			return nil, errRangeNotSatisfiable
+		}
+
+		return nil, errInvalidRange
+	}
+
+	return ranges, nil
+}
@@ -0,0 +1,89 @@
+package httpcore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Reader is responsible for reading from the connection
+type Reader struct {
+	// reader is a buffered reader for the connection
+	reader *bufio.Reader
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{
+		reader: bufio.NewReader(rd),
+	}
+}
+
+var ErrExpectedTrailingCRLF = errors.New("expected trailing CRLF")
+var ErrLineTooLong = errors.New("line too long")
+
+// ReadLine reads until delimiter '\n' from the reader and
+// checks for valid CRLF('\r\n').
+// It returns the line(string) without CRLF('\r\n').
+//
+// Lines longer than DefaultMaxHeaderBytes (CRLF included) are not
+// buffered whole, ErrLineTooLong is returned instead.
+//
+// Note: It returns string because HTTP request line & headers
+// are ASCII text
+func (r *Reader) ReadLine() (string, error) {
+	return r.readLine(DefaultMaxHeaderBytes)
+}
+
+// readLine is ReadLine for lines of at most limit bytes.
+func (r *Reader) readLine(limit int) (string, error) {
+	var line []byte
+
+	for {
+		// ReadSlice never buffers more than the bufio.Reader's size,
+		// so a client can't make us hold an endless line
+		frag, err := r.reader.ReadSlice('\n')
+
+		if len(line)+len(frag) > limit {
+			return "", ErrLineTooLong
+		}
+
+		line = append(line, frag...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		break
+	}
+
+	// Check for valid CRLF('\r\n')
+	if !bytes.HasSuffix(line, CRLF) {
+		return "", ErrExpectedTrailingCRLF
+	}
+
+	return string(line[:len(line)-2]), nil
+}
+
+// ReadN reads n bytes from reader.
+// The bytes are taken from at most one Read on the underlying Reader,
+// hence bytes read may be less than n.
+func (r *Reader) ReadN(n int) (bytesRead int, buf []byte, err error) {
+	buf = make([]byte, n)
+
+	bytesRead, err = r.reader.Read(buf)
+
+	return
+}
+
+// Read reads up to len(p) bytes from the buffered connection.
+//
+// It lets message bodies be read through the same buffer as the
+// request line and headers, so no bytes are lost between the two.
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
+}
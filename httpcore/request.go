@@ -0,0 +1,476 @@
+package httpcore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Represents a HTTP request received by the server.
+type Request struct {
+	// It specifies the HTTP methods(GET, POST, PUT, etc).
+	Method string
+
+	// URL specifies the URI being requested
+	//
+	// The URL is parsed from the URI on the Request-Line (See RFC 7230, Section 5.3)
+	URL *URL
+
+	Protocol      string // "HTTP/1.1"
+	ProtocolMajor int    // 1
+	ProtocolMinor int    // 0
+
+	// It contains the request header fields received by
+	// the server
+	//
+	// If a server received a request with header lines,
+	//
+	// Host: example.com
+	// accept-encoding: gzip, deflate
+	// fOO: Bar
+	// foo: two
+	//
+	// then
+	//
+	// Header = map[string][]string{
+	// 	"Accept-Encoding": {"gzip, deflate"},
+	// 	"Foo": {"Bar", "two"}
+	// }
+	Header Header
+
+	// Host specifies the host on which the URL is sought. For
+	// HTTP/1(per RFC 7230, section 5.4), this is either the value
+	// of the "Host" header or the host name givent in the URL itself
+	//
+	Host string
+
+	// RequestURI is the unmodified request-target of the
+	// Request-Line (per RFC 7230, section 3.1.1) as sent by
+	// the client to a server.
+	RequestURI string
+
+	// Body is the request's message body.
+	//
+	// It is never nil; requests without a body get NoBody. Reads
+	// stop at the end of the message, and the server closes the
+	// body (discarding what the handler did not read) once the
+	// response has been written.
+	Body io.ReadCloser
+
+	// ContentLength is the length of the body in bytes, taken from
+	// the Content-Length header. It is 0 when there is no body and
+	// -1 when the length is unknown (chunked transfer coding).
+	ContentLength int64
+
+	// Trailer holds the trailer fields sent after a chunked body.
+	//
+	// It is only filled in once Body has been read to io.EOF.
+	Trailer Header
+
+	// pathParams holds the path parameters matched by the Router
+	pathParams map[string]string
+
+	// ctx is canceled when the handler returns or the client can
+	// no longer be written to
+	ctx context.Context
+}
+
+// Context returns the request's context.
+//
+// It is canceled when the handler returns, or earlier once writing
+// the response fails because the client went away.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+// PathValue returns the value of the path parameter name matched by
+// the Router, e.g. "42" for "{id}" in "GET /users/{id}" when serving
+// "/users/42".
+//
+// It returns the empty string if the route has no such parameter.
+func (r *Request) PathValue(name string) string {
+	return r.pathParams[name]
+}
+
+var ErrMalformedRequestLine = errors.New("malformed request line.")
+var ErrInvalidRequestMethod = errors.New("invalid request method")
+var ErrMethodNotImplemented = errors.New("method not implemented")
+var ErrRequestLineTooLong = errors.New("request line too long")
+var ErrHeaderTooLarge = errors.New("request header fields too large")
+
+// DefaultMaxHeaderBytes limits the request line and header section
+// when Server.MaxHeaderBytes is not set.
+const DefaultMaxHeaderBytes = 1 << 20 // 1 MiB
+
+// DefaultMaxHeaderFields limits the number of header fields when
+// Server.MaxHeaderFields is not set.
+const DefaultMaxHeaderFields = 100
+
+// requestLimits bound what readRequest accepts from a client.
+type requestLimits struct {
+	maxHeaderBytes  int // request line and header section, CRLFs included
+	maxHeaderFields int
+	maxBodyBytes    int64
+}
+
+func badStringError(err, val string) error { return fmt.Errorf("%s %q", err, val) }
+
+// readRequest reads the next request from the connection.
+//
+// A nil response means nothing could be answered (the client went
+// away or sent no request line) and the connection should just be
+// dropped. Otherwise the returned response can be used to reply
+// with an error status.
+//
+// A client too slow to send the headers gets ErrReadHeaderTimeout,
+// which is always answered.
+func (c *conn) readRequest() (*response, error) {
+	req, err := readRequest(c.r, c.server.requestLimits())
+
+	if isTimeout(err) {
+		err = fmt.Errorf("%w: %w", ErrReadHeaderTimeout, err)
+
+		if req == nil {
+			req = placeholderRequest()
+		}
+	}
+
+	c.setRequestDeadlines()
+
+	if req == nil {
+		return nil, err
+	}
+
+	res := newResponse(c.bufw, req)
+	res.conn = c
+
+	return res, err
+}
+
+// placeholderRequest stands in for a request whose request line
+// could not be read, so it can still be answered.
+func placeholderRequest() *Request {
+	return &Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1, Header: make(Header), Body: NoBody}
+}
+
+// readRequest parses the next request from r.
+//
+// On error the request is nil if no request line could be read,
+// otherwise it holds what was parsed so far so the error can be
+// answered.
+func readRequest(r *Reader, limits requestLimits) (req *Request, err error) {
+	req = &Request{Body: NoBody}
+
+	// HTTP request-line = method SP request-target SP HTTP-version CRLF
+	// Where SP = Single Space
+	var reqLine string
+	reqLine, err = r.readLine(limits.maxHeaderBytes)
+	if err == ErrLineTooLong {
+		// Too long to parse, answer as an HTTP/1.1 request
+		return placeholderRequest(), ErrRequestLineTooLong
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	var ok bool
+	req.Method, req.RequestURI, req.Protocol, ok = parseRequestLine(reqLine)
+	if !ok {
+		return req, badStringError("malformed HTTP request", reqLine)
+	}
+
+	if len(req.RequestURI) == 0 {
+		return req, ErrMalformedRequestLine
+	}
+
+	if !validMethod(req.Method) {
+		return req, ErrInvalidRequestMethod
+	}
+
+	if !knownMethod(req.Method) {
+		return req, ErrMethodNotImplemented
+	}
+
+	// parse url from req.RequestURI
+	if req.URL, err = parseRequestTarget(req.Method, req.RequestURI); err != nil {
+		return req, err
+	}
+
+	// parse http version
+	if req.ProtocolMajor, req.ProtocolMinor, ok = parseHttpVersion(req.Protocol); !ok {
+		return req, badStringError("malformed HTTP version", req.Protocol)
+	}
+
+	// Parse headers
+	// header-field   = field-name ":" OWS field-value OWS  (Where OWS = Optional White Space)
+	headerBytes := limits.maxHeaderBytes - len(reqLine) - len(CRLF)
+
+	req.Header, err = parseHeaders(r, headerBytes, limits.maxHeaderFields)
+	if err != nil {
+		return req, err
+	}
+
+	if req.Host, err = requestHost(req); err != nil {
+		return req, err
+	}
+
+	// Message body (RFC 7230, section 3.3.3)
+	if err = readBody(req, r, limits); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// readBody sets up req.Body from the request's framing headers
+// (RFC 7230, section 3.3.3).
+//
+// The body itself is not read here; the handler pulls it from the
+// connection through req.Body.
+func readBody(req *Request, r *Reader, limits requestLimits) error {
+	// Transfer-Encoding overrides Content-Length, but a request with
+	// both may be framed differently by a proxy in front of us, which
+	// is how requests get smuggled (RFC 7230, section 3.3.3)
+	if te := req.Header.Values("Transfer-Encoding"); len(te) > 0 {
+		if len(req.Header.Values("Content-Length")) > 0 {
+			return ErrConflictingFraming
+		}
+
+		if !isChunked(te) {
+			return ErrUnsupportedTransferEncoding
+		}
+
+		req.ContentLength = -1
+		req.Trailer = make(Header)
+		req.Body = &body{src: newChunkedReader(r, limits, req.Trailer)}
+
+		return nil
+	}
+
+	cl, err := contentLengthValue(req.Header.Values("Content-Length"))
+	if err != nil || len(cl) == 0 {
+		return err
+	}
+
+	n, err := parseContentLength(cl)
+	if err != nil {
+		return err
+	}
+
+	// Refuse before reading anything so a client can't make us
+	// buffer (or drain) an arbitrarily large upload
+	if n > limits.maxBodyBytes {
+		return ErrBodyTooLarge
+	}
+
+	req.ContentLength = n
+
+	if n > 0 {
+		req.Body = &body{src: &fixedLengthReader{r: r, n: n}}
+	}
+
+	return nil
+}
+
+var ErrConflictingFraming = errors.New("request has both Content-Length and Transfer-Encoding")
+var ErrConflictingContentLength = errors.New("request has conflicting Content-Length values")
+
+// contentLengthValue returns the request's Content-Length, or "" if
+// it has none. Repeated values (as several fields or a list) are
+// only accepted if they are all the same (RFC 7230, section 3.3.2).
+func contentLengthValue(values []string) (string, error) {
+	var cl string
+
+	for _, v := range values {
+		for _, n := range strings.Split(v, ",") {
+			n = strings.TrimSpace(n)
+
+			if len(cl) > 0 && n != cl {
+				return "", ErrConflictingContentLength
+			}
+
+			cl = n
+		}
+	}
+
+	if len(values) > 0 && len(cl) == 0 {
+		return "", ErrInvalidContentLength
+	}
+
+	return cl, nil
+}
+
+var ErrMissingHost = errors.New("missing or invalid Host header")
+
+// requestHost picks the host the request is for (RFC 7230, section 5.4).
+//
+// A host in the request-target wins over the Host header. HTTP/1.1
+// requests must carry exactly one Host header, even if empty.
+func requestHost(req *Request) (string, error) {
+	hosts := req.Header.Values("Host")
+
+	if len(hosts) > 1 || (len(hosts) == 0 && req.ProtocolAtLeast(1, 1)) {
+		return "", ErrMissingHost
+	}
+
+	if len(req.URL.Host) > 0 {
+		return req.URL.Host, nil
+	}
+
+	if len(hosts) == 0 {
+		return "", nil
+	}
+
+	if strings.ContainsAny(hosts[0], " \t/?#@") {
+		return "", ErrMissingHost
+	}
+
+	return strings.ToLower(hosts[0]), nil
+}
+
+// isChunked reports whether the Transfer-Encoding values are
+// exactly "chunked".
+//
+// Other codings (gzip, deflate, ...) are not supported.
+func isChunked(te []string) bool {
+	var codings []string
+
+	for _, v := range te {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); len(c) > 0 {
+				codings = append(codings, strings.ToLower(c))
+			}
+		}
+	}
+
+	return len(codings) == 1 && codings[0] == "chunked"
+}
+
+// ProtocolAtLeast reports whether the HTTP version used in the
+// request is at least major.minor
+func (r *Request) ProtocolAtLeast(major, minor int) bool {
+	return r.ProtocolMajor > major ||
+		r.ProtocolMajor == major && r.ProtocolMinor >= minor
+}
+
+var ErrInvalidHeaderField = errors.New("invalid header field")
+var ErrInvalidHeaderName = errors.New("invalid header field name")
+var ErrInvalidHeaderValue = errors.New("invalid header field value")
+var ErrObsoleteLineFolding = errors.New("obsolete line folding in header")
+
+// parseHeaders reads a header section of at most maxBytes bytes
+// (CRLFs and the final empty line included) and maxFields fields.
+// Larger sections fail with ErrHeaderTooLarge.
+func parseHeaders(r *Reader, maxBytes, maxFields int) (Header, error) {
+	h := make(Header)
+	fields := 0
+
+	// Sample request(after request line)
+	// Host: localhost:8080\r\nUser-Agent: curl/8.0.0\r\nAccept: */*\r\nConnection: close\r\n\r\n
+	for {
+		line, err := r.readLine(maxBytes)
+		if err == ErrLineTooLong {
+			return nil, ErrHeaderTooLarge
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		maxBytes -= len(line) + len(CRLF)
+
+		// Reached end of headers
+		if len(line) == 0 {
+			return h, nil
+		}
+
+		if fields++; fields > maxFields {
+			return nil, ErrHeaderTooLarge
+		}
+
+		// A line starting with whitespace continues the previous
+		// field (obs-fold). Servers may unfold it or reject the
+		// request (RFC 7230, section 3.2.4); unfolding is how
+		// proxies get tricked into disagreeing about headers, so
+		// we reject it.
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, ErrObsoleteLineFolding
+		}
+
+		// header-field = field-name ":" OWS field-value OWS
+		k, v, found := strings.Cut(line, ":")
+
+		if !found {
+			return nil, ErrInvalidHeaderField
+		}
+
+		// No whitespace is allowed between the field name and the
+		// colon, a token can't contain any
+		if !validHeaderFieldName(k) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidHeaderName, k)
+		}
+
+		// OWS is SP / HTAB only
+		vsr := strings.Trim(v, " \t")
+		if !validHeaderFieldValue(vsr) {
+			return nil, fmt.Errorf("%w for %s", ErrInvalidHeaderValue, k)
+		}
+
+		h.Add(k, vsr)
+	}
+}
+
+func parseHttpVersion(protocol string) (majorProto, minorProto int, ok bool) {
+	// HTTP/1.1
+	switch protocol {
+	case "HTTP/1.1":
+		return 1, 1, true
+	case "HTTP/1.0":
+		return 1, 0, true
+	default:
+		return 0, 0, false
+	}
+
+	// if !strings.HasPrefix(protocol, "HTTP/"){
+	// 	return 0, 0, false
+	// }
+	// if len(protocol) != len("HTTP/X.Y"){
+	// 	return 0, 0, false
+	// }
+	// if protocol[6] != '.'{
+	// 	return 0, 0, false
+	// }
+}
+
+// NewRequest forms and returns *Request using the requst line
+func parseRequestLine(requestLine string) (method, requestUri, proto string, ok bool) {
+	// requestLine = method SP request-target SP HTTP-version
+	// We cut on SP(Single Space)
+	method, rest, ok1 := strings.Cut(requestLine, " ")
+	requestURI, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return "", "", "", false
+	}
+
+	return method, requestURI, proto, true
+}
+
+// validMethod reports whether m is syntactically a method
+//
+// method = token
+func validMethod(m string) bool {
+	return isToken(m)
+}
@@ -0,0 +1,308 @@
+package httpcore
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// readTestRequest feeds raw into readRequest over an in-memory conn.
+func readTestRequest(t *testing.T, raw string, maxBodyBytes int64) (*Reader, *response, error) {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	go func() {
+		io.WriteString(client, raw)
+	}()
+
+	c := (&Server{MaxBodyBytes: maxBodyBytes}).newConn(server)
+	res, err := c.readRequest()
+
+	return c.r, res, err
+}
+
+func TestReadRequestBody(t *testing.T) {
+	raw := "POST /users HTTP/1.1\r\nHost: localhost\r\nContent-Length: 13\r\n\r\n{\"id\": \"42\"}\n"
+
+	_, res, err := readTestRequest(t, raw, DefaultMaxBodyBytes)
+	if err != nil {
+		t.Fatalf("readRequest: %s", err)
+	}
+
+	if res.req.ContentLength != 13 {
+		t.Fatalf("Expected ContentLength 13, got %d", res.req.ContentLength)
+	}
+
+	b, err := io.ReadAll(res.req.Body)
+	if err != nil {
+		t.Fatalf("reading body: %s", err)
+	}
+
+	if string(b) != "{\"id\": \"42\"}\n" {
+		t.Fatalf("Expected body %q, got %q", "{\"id\": \"42\"}\n", b)
+	}
+}
+
+func TestReadRequestBodyTooLarge(t *testing.T) {
+	raw := "POST /users HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\n"
+
+	_, res, err := readTestRequest(t, raw, 10)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Expected ErrBodyTooLarge, got %v", err)
+	}
+
+	if res == nil {
+		t.Fatalf("Expected a response to reply with")
+	}
+}
+
+func TestReadRequestInvalidContentLength(t *testing.T) {
+	for _, cl := range []string{"-1", "+5", "1 2", "abc"} {
+		raw := "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: " + cl + "\r\n\r\n"
+
+		_, _, err := readTestRequest(t, raw, DefaultMaxBodyBytes)
+		if !errors.Is(err, ErrInvalidContentLength) {
+			t.Fatalf("Content-Length %q: expected ErrInvalidContentLength, got %v", cl, err)
+		}
+	}
+}
+
+func TestBodyCloseDrainsUnreadBytes(t *testing.T) {
+	raw := "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello" +
+		"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n"
+
+	reader, res, err := readTestRequest(t, raw, DefaultMaxBodyBytes)
+	if err != nil {
+		t.Fatalf("readRequest: %s", err)
+	}
+
+	if err := res.req.Body.Close(); err != nil {
+		t.Fatalf("closing body: %s", err)
+	}
+
+	// The next request must start right after the discarded body
+	line, err := reader.ReadLine()
+	if err != nil {
+		t.Fatalf("reading next request line: %s", err)
+	}
+
+	if line != "GET /next HTTP/1.1" {
+		t.Fatalf("Expected next request line, got %q", line)
+	}
+}
+
+func TestReadRequestChunkedBody(t *testing.T) {
+	raw := "POST /upload HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5;name=value\r\nhello\r\n" +
+		"7\r\n, world\r\n" +
+		"0\r\nChecksum: abc123\r\n\r\n"
+
+	_, res, err := readTestRequest(t, raw, DefaultMaxBodyBytes)
+	if err != nil {
+		t.Fatalf("readRequest: %s", err)
+	}
+
+	if res.req.ContentLength != -1 {
+		t.Fatalf("Expected ContentLength -1, got %d", res.req.ContentLength)
+	}
+
+	b, err := io.ReadAll(res.req.Body)
+	if err != nil {
+		t.Fatalf("reading body: %s", err)
+	}
+
+	if string(b) != "hello, world" {
+		t.Fatalf("Expected body %q, got %q", "hello, world", b)
+	}
+
+	if v := res.req.Trailer.Get("Checksum"); v != "abc123" {
+		t.Fatalf("Expected trailer Checksum abc123, got %q", v)
+	}
+}
+
+func TestReadRequestChunkedBodyTooLarge(t *testing.T) {
+	raw := "POST /upload HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"10\r\n0123456789abcdef\r\n0\r\n\r\n"
+
+	_, res, err := readTestRequest(t, raw, 8)
+	if err != nil {
+		t.Fatalf("readRequest: %s", err)
+	}
+
+	if _, err := io.ReadAll(res.req.Body); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Expected ErrBodyTooLarge, got %v", err)
+	}
+}
+
+func TestReadRequestTrailerLimits(t *testing.T) {
+	s := &Server{MaxHeaderBytes: 128, MaxHeaderFields: 3}
+
+	for name, tc := range map[string]struct {
+		trailer string
+		want    error
+	}{
+		"trailer bytes":  {"X-Big: " + strings.Repeat("a", 128) + "\r\n", ErrHeaderTooLarge},
+		"trailer fields": {"A: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n", ErrHeaderTooLarge},
+		"within limits":  {"A: 1\r\nB: 2\r\n", nil},
+	} {
+		raw := "POST /upload HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"5\r\nhello\r\n0\r\n" + tc.trailer + "\r\n"
+
+		client, server := net.Pipe()
+		go io.WriteString(client, raw)
+
+		res, err := s.newConn(server).readRequest()
+		if err != nil {
+			t.Fatalf("%s: readRequest: %s", name, err)
+		}
+
+		if _, err := io.ReadAll(res.req.Body); err != tc.want {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestReadRequestMethods(t *testing.T) {
+	for _, m := range []string{MethodGet, MethodHead, MethodPost, MethodPut, MethodPatch, MethodDelete, MethodOptions, MethodTrace} {
+		raw := m + " / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+
+		if _, _, err := readTestRequest(t, raw, DefaultMaxBodyBytes); err != nil {
+			t.Fatalf("%s: %s", m, err)
+		}
+	}
+
+	raw := "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n"
+	if _, _, err := readTestRequest(t, raw, DefaultMaxBodyBytes); err != nil {
+		t.Fatalf("CONNECT: %s", err)
+	}
+
+	raw = "PURGE / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	if _, _, err := readTestRequest(t, raw, DefaultMaxBodyBytes); !errors.Is(err, ErrMethodNotImplemented) {
+		t.Fatalf("Expected ErrMethodNotImplemented, got %v", err)
+	}
+
+	raw = "G(T / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	if _, _, err := readTestRequest(t, raw, DefaultMaxBodyBytes); !errors.Is(err, ErrInvalidRequestMethod) {
+		t.Fatalf("Expected ErrInvalidRequestMethod, got %v", err)
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	raw := "GET /chat?room=1 HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\n\r\n"
+	limits := (&Server{}).requestLimits()
+
+	req, err := readRequest(NewReader(strings.NewReader(raw)), limits)
+	if err != nil {
+		t.Fatalf("readRequest: %s", err)
+	}
+
+	if req.URL.Path != "/chat" || req.URL.Query().Get("room") != "1" || req.Header.Get("Upgrade") != "websocket" {
+		t.Fatalf("Unexpected request %+v", req)
+	}
+
+	if _, err := readRequest(NewReader(strings.NewReader("GET /\r\n\r\n")), limits); err == nil {
+		t.Fatalf("Expected an error for a malformed request line")
+	}
+}
+
+func TestReadRequestHeaderLimits(t *testing.T) {
+	s := &Server{MaxHeaderBytes: 64, MaxHeaderFields: 3}
+
+	for name, tc := range map[string]struct {
+		raw  string
+		want error
+	}{
+		"request line": {
+			"GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			ErrRequestLineTooLong,
+		},
+		"header bytes": {
+			"GET / HTTP/1.1\r\nHost: localhost\r\nX-Big: " + strings.Repeat("a", 32) + "\r\n\r\n",
+			ErrHeaderTooLarge,
+		},
+		"header fields": {
+			"GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+			ErrHeaderTooLarge,
+		},
+		"within limits": {
+			"GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\n\r\n",
+			nil,
+		},
+	} {
+		client, server := net.Pipe()
+		go io.WriteString(client, tc.raw)
+
+		res, err := s.newConn(server).readRequest()
+		if err != tc.want {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+
+		if err != nil && res == nil {
+			t.Errorf("%s: no response to answer the error with", name)
+		}
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestReadLineLimit(t *testing.T) {
+	// Longer than the bufio.Reader's buffer, so it arrives in pieces
+	reader := NewReader(strings.NewReader(strings.Repeat("a", 5000) + "\r\nnext\r\n"))
+
+	if _, err := reader.readLine(4096); err != ErrLineTooLong {
+		t.Fatalf("Expected ErrLineTooLong, got %v", err)
+	}
+
+	reader = NewReader(strings.NewReader(strings.Repeat("a", 5000) + "\r\n"))
+
+	line, err := reader.readLine(5002)
+	if err != nil || len(line) != 5000 {
+		t.Fatalf("Expected the 5000 byte line, got %d bytes, %v", len(line), err)
+	}
+}
+
+func TestReadRequestRejectsInvalidHeaders(t *testing.T) {
+	for name, tc := range map[string]struct {
+		headers string
+		want    error
+	}{
+		"space before colon":   {"Host : localhost\r\n", ErrInvalidHeaderName},
+		"non-token name":       {"Host: localhost\r\nX(1): a\r\n", ErrInvalidHeaderName},
+		"NUL in value":         {"Host: localhost\r\nX-A: a\x00b\r\n", ErrInvalidHeaderValue},
+		"CR in value":          {"Host: localhost\r\nX-A: a\rb\r\n", ErrInvalidHeaderValue},
+		"obs-fold":             {"Host: localhost\r\nX-A: a\r\n b\r\n", ErrObsoleteLineFolding},
+		"CL and TE":            {"Host: localhost\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n", ErrConflictingFraming},
+		"different CL fields":  {"Host: localhost\r\nContent-Length: 5\r\nContent-Length: 6\r\n", ErrConflictingContentLength},
+		"different CL in list": {"Host: localhost\r\nContent-Length: 5, 6\r\n", ErrConflictingContentLength},
+	} {
+		raw := "POST / HTTP/1.1\r\n" + tc.headers + "\r\n"
+
+		_, res, err := readTestRequest(t, raw, DefaultMaxBodyBytes)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+
+		if res == nil {
+			t.Errorf("%s: expected a response to answer with", name)
+		}
+	}
+
+	// The same length repeated is fine
+	raw := "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello"
+
+	_, res, err := readTestRequest(t, raw, DefaultMaxBodyBytes)
+	if err != nil || res.req.ContentLength != 5 {
+		t.Fatalf("Expected a 5 byte body, got %v", err)
+	}
+}
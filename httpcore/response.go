@@ -0,0 +1,534 @@
+package httpcore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bufferBeforeChunkingSize is how much of the body is held back
+// before the headers are sent. Responses that fit are sent with a
+// Content-Length; larger ones are streamed (chunked for HTTP/1.1
+// clients, close-delimited for HTTP/1.0 ones).
+const bufferBeforeChunkingSize = 4 << 10 // 4 KiB
+
+// TimeFormat is the format of HTTP dates (RFC 7231, section 7.1.1.1),
+// always in GMT, e.g. "Sun, 06 Nov 1994 08:49:37 GMT".
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var ErrContentLength = errors.New("wrote more than the declared Content-Length")
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+// Response represesnts the server side of an HTTP response
+type response struct {
+	conn *conn
+
+	req *Request
+
+	header Header
+
+	wroteHeader bool // Tells that a non 1xx header has been written
+
+	status int // status code passed to WriteHeader
+
+	w *bufio.Writer
+
+	body []byte // buffered response body, until the headers are sent
+
+	headerSent bool // status line and headers have been written to w
+
+	chunking bool // body is sent with chunked transfer coding
+
+	contentLength int64 // Content-Length declared by the handler, -1 if none
+
+	written int64 // body bytes written by the handler
+
+	wantKeepAlive bool // Used for Connection header
+
+	closeAfterReply bool // connection is closed once this response is sent
+
+	cancel context.CancelFunc // cancels the request context
+
+	headerErr error // the handler's headers were invalid, a 500 was sent instead
+}
+
+func newResponse(w *bufio.Writer, req *Request) *response {
+	return &response{
+		req:           req,
+		header:        make(Header),
+		contentLength: -1,
+		w:             w,
+	}
+}
+
+// Response answers a single request on a connection the caller
+// manages itself, usually one taken over with Hijacker. The response
+// always ends with "Connection: close", except for a 101 Switching
+// Protocols which hands the connection over to another protocol.
+//
+// Nothing is written before FinalizeResponse (or Flush) is called.
+type Response struct {
+	*response
+}
+
+// NewResponse returns a Response to req written to w.
+//
+// req may be nil when the request could not be read; the response
+// is then sent as for an HTTP/1.1 GET.
+func NewResponse(w io.Writer, req *Request) *Response {
+	if req == nil {
+		req = placeholderRequest()
+	}
+
+	return &Response{newResponse(bufio.NewWriter(w), req)}
+}
+
+// FinalizeResponse sends the response, or its end if it was already
+// flushed.
+func (r *Response) FinalizeResponse() {
+	r.finalizeResponse()
+}
+
+func (r *response) Header() Header {
+	// returns the headers
+	return r.header
+}
+
+func (r *response) WriteHeader(code int) {
+	// Write headers if not already written
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.status = code
+	}
+}
+
+func (r *response) Write(data []byte) (n int, err error) {
+	return r.write(len(data), data, "")
+}
+
+func (r *response) WriteString(data string) (n int, err error) {
+	return r.write(len(data), nil, data)
+}
+
+func (r *response) write(size int, dataB []byte, dataS string) (n int, err error) {
+	if r.hijacked() {
+		return 0, ErrHijacked
+	}
+
+	if r.headerErr != nil {
+		return 0, r.headerErr
+	}
+
+	// Write header if not written
+	if !r.wroteHeader {
+		r.WriteHeader(StatusOK)
+	}
+
+	if !BodyAllowedForStatus(r.status) {
+		return 0, ErrBodyNotAllowed
+	}
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	if dataB == nil {
+		dataB = []byte(dataS)
+	}
+
+	if !r.headerSent {
+		r.declareContentLength()
+	}
+
+	if r.contentLength != -1 && r.written+int64(size) > r.contentLength {
+		return 0, ErrContentLength
+	}
+
+	r.written += int64(size)
+
+	// A HEAD response has no body. Only the length is kept so the
+	// Content-Length matches what GET would have sent.
+	if r.req.Method == MethodHead {
+		return size, nil
+	}
+
+	if r.headerSent {
+		return size, r.checkWrite(r.writeBody(dataB))
+	}
+
+	r.body = append(r.body, dataB...)
+
+	if len(r.body) <= bufferBeforeChunkingSize {
+		return size, nil
+	}
+
+	// The body outgrew the buffer. Send the headers now and
+	// stream everything from here on.
+	if err := r.writeHeaders(); err != nil {
+		return 0, r.checkWrite(err)
+	}
+
+	buffered := r.body
+	r.body = nil
+
+	return size, r.checkWrite(r.writeBody(buffered))
+}
+
+// Flush sends the headers, if not yet sent, and everything written
+// so far to the client.
+func (r *response) Flush() error {
+	if r.hijacked() {
+		return ErrHijacked
+	}
+
+	if !r.wroteHeader {
+		r.WriteHeader(StatusOK)
+	}
+
+	if !r.headerSent {
+		if err := r.writeHeaders(); err != nil {
+			return r.checkWrite(err)
+		}
+
+		buffered := r.body
+		r.body = nil
+
+		if err := r.writeBody(buffered); err != nil {
+			return r.checkWrite(err)
+		}
+	}
+
+	return r.checkWrite(r.flush())
+}
+
+// checkWrite cancels the request context when writing to the
+// client failed, so the handler can stop early. It returns err,
+// as an ErrWriteTimeout if the write deadline passed.
+func (r *response) checkWrite(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if r.cancel != nil {
+		r.cancel()
+	}
+
+	if isTimeout(err) {
+		err = fmt.Errorf("%w: %w", ErrWriteTimeout, err)
+	}
+
+	return err
+}
+
+// Hijack lets the handler take over the connection, see Hijacker.
+func (r *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.conn == nil {
+		return nil, nil, ErrNotHijackable
+	}
+
+	return r.conn.hijack()
+}
+
+func (r *response) hijacked() bool {
+	return r.conn != nil && r.conn.hijacked
+}
+
+// Parse the response and send to wire(conn)
+func (r *response) finalizeResponse() {
+	// write status-line
+	if !r.wroteHeader {
+		r.WriteHeader(StatusOK)
+	}
+
+	var err error
+
+	switch {
+	case r.headerErr != nil:
+		// The 500 that replaced the response is complete
+
+	case !r.headerSent:
+		// The whole body is buffered (or, for HEAD, counted), so its
+		// length is known, unless the handler declared it itself.
+		// 1xx, 204 and 304 responses have no body to measure.
+		r.declareContentLength()
+
+		if len(r.Header().Get("Content-Length")) == 0 && BodyAllowedForStatus(r.status) {
+			r.Header().Set("Content-Length", strconv.FormatInt(r.written, 10))
+		}
+
+		// The client waits for the rest of a short body, only
+		// closing the connection ends it
+		shortErr := r.shortBody()
+		if shortErr != nil {
+			r.Header().Set("Connection", "close")
+		}
+
+		if err = r.writeHeaders(); err == nil {
+			err = r.writeBody(r.body)
+		}
+
+		if err == nil {
+			err = shortErr
+		}
+
+	case r.chunking:
+		err = writeLastChunk(r.w)
+
+	default:
+		if err = r.shortBody(); err != nil {
+			r.closeAfterReply = true
+		}
+	}
+
+	// failHeaders logged its own error
+	if err != nil && err != r.headerErr {
+		slog.Error(err.Error())
+	}
+
+	err = r.flush()
+
+	if err != nil {
+		if isTimeout(err) {
+			err = fmt.Errorf("%w: %w", ErrWriteTimeout, err)
+		}
+
+		slog.Error(err.Error())
+
+		// The writer is broken, so is the connection
+		r.closeAfterReply = true
+	}
+}
+
+// declareContentLength takes the Content-Length the handler set, so
+// writes past it fail before anything is sent. An invalid value is
+// rejected when the headers are sent.
+func (r *response) declareContentLength() {
+	if r.contentLength != -1 || !BodyAllowedForStatus(r.status) {
+		return
+	}
+
+	if cl := r.Header().Get("Content-Length"); len(cl) > 0 {
+		if n, err := parseContentLength(cl); err == nil {
+			r.contentLength = n
+		}
+	}
+}
+
+// shortBody reports the handler writing less than the Content-Length
+// it declared. A HEAD handler doesn't have to write anything.
+func (r *response) shortBody() error {
+	if r.contentLength == -1 || r.written >= r.contentLength || r.req.Method == MethodHead {
+		return nil
+	}
+
+	return fmt.Errorf("handler wrote %d bytes, declared Content-Length %d", r.written, r.contentLength)
+}
+
+// writeHeaders writes the status line and the header section.
+//
+// It picks the body framing: the handler's own Content-Length if it
+// set one, otherwise chunked for HTTP/1.1 clients. HTTP/1.0 clients
+// don't understand chunked, so their body ends when the connection
+// is closed.
+func (r *response) writeHeaders() error {
+	if err := r.validateHeaders(); err != nil {
+		return r.failHeaders(err)
+	}
+
+	// example status line : "HTTP/1.1 <status-code> <reason-phrase>\r\n"
+	var sb strings.Builder
+
+	sb.WriteString("HTTP/1.1 ")
+	sb.WriteString(strconv.Itoa(r.status) + " ")
+	sb.WriteString(StatusText(r.status))
+	sb.Write(CRLF)
+
+	hasBody := r.req.Method != MethodHead && BodyAllowedForStatus(r.status)
+
+	if !BodyAllowedForStatus(r.status) {
+		// 1xx and 204 responses must not have framing headers. A 304
+		// may keep the Content-Length of the representation it
+		// stands for, but it still ends with the header section.
+		if r.status != StatusNotModified {
+			r.Header().Del("Content-Length")
+		}
+
+		r.Header().Del("Transfer-Encoding")
+	} else if cl := r.Header().Get("Content-Length"); len(cl) > 0 {
+		n, err := parseContentLength(cl)
+		if err != nil {
+			return r.failHeaders(badStringError("invalid response Content-Length", cl))
+		}
+
+		r.contentLength = n
+	} else if hasBody && r.req.ProtocolAtLeast(1, 1) {
+		r.chunking = true
+		r.Header().Set("Transfer-Encoding", "chunked")
+	}
+
+	// A close-delimited body can only end by closing the connection,
+	// and the handler may ask for the connection to be closed
+	r.closeAfterReply = !r.wantKeepAlive ||
+		(hasBody && !r.chunking && r.contentLength == -1) ||
+		r.Header().HasToken("Connection", "close")
+
+	// Set Auto headers
+	r.setAutoHeaders()
+
+	// Parse Headers
+	for k, v := range r.Header() {
+		sb.WriteString(k)
+		sb.WriteString(": ")
+
+		// comma separeted values
+		for i, vv := range v {
+			// No comma for last element
+			if i == len(v)-1 {
+				sb.WriteString(vv)
+			} else {
+				sb.WriteString(vv + ", ")
+			}
+		}
+
+		sb.Write(CRLF)
+	}
+
+	sb.Write(CRLF)
+
+	// write status line and headers
+	if _, err := r.writeToWire(nil, sb.String()); err != nil {
+		return err
+	}
+
+	r.headerSent = true
+
+	return nil
+}
+
+// writeBody writes body bytes to the wire, framing them as a
+// chunk when the response is chunked.
+func (r *response) writeBody(data []byte) error {
+	if r.req.Method == MethodHead {
+		return nil
+	}
+
+	if r.chunking {
+		return writeChunk(r.w, data)
+	}
+
+	_, err := r.writeToWire(data, "")
+
+	return err
+}
+
+// Writes bytes to the wire(conn)
+func (r *response) writeToWire(dataB []byte, dataS string) (n int, err error) {
+	if dataB != nil {
+		return r.w.Write(dataB)
+	} else {
+		return r.w.Write([]byte(dataS))
+	}
+}
+
+// validateHeaders checks the handler's header fields (RFC 7230,
+// section 3.2). A CR or LF in a value would let whoever controls it
+// add fields or a whole second response (response splitting).
+func (r *response) validateHeaders() error {
+	for k, v := range r.Header() {
+		if !validHeaderFieldName(k) {
+			return badStringError("invalid response header field name", k)
+		}
+
+		for _, vv := range v {
+			if !validHeaderFieldValue(vv) {
+				return badStringError("invalid response header field value for", k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// failHeaders sends a bare 500 instead of headers that can't be
+// sent as they are, and closes the connection afterwards. The
+// handler's later writes fail with err.
+func (r *response) failHeaders(err error) error {
+	slog.Error(err.Error())
+
+	r.headerErr = err
+	r.headerSent = true
+	r.chunking = false
+	r.closeAfterReply = true
+
+	head := "HTTP/1.1 500 " + StatusText(StatusInternalServerError) + "\r\n" +
+		"Content-Length: 0\r\nConnection: close\r\n\r\n"
+
+	if _, werr := r.writeToWire(nil, head); werr != nil {
+		return werr
+	}
+
+	return err
+}
+
+// Sets Date, Content-Type, Connection
+func (r *response) setAutoHeaders() {
+	// Date
+	r.Header().Add("Date", time.Now().UTC().Format(TimeFormat))
+
+	// Connection
+	//
+	// HTTP/1.1 connections persist by default, HTTP/1.0 ones have to
+	// be told explicitly that the connection stays open
+	switch {
+	case r.status == StatusSwitchingProtocols:
+		// The connection is handed over to another protocol, the
+		// handler's "Connection: Upgrade" stays as is
+	case r.closeAfterReply:
+		r.Header().Set("Connection", "close")
+	case !r.req.ProtocolAtLeast(1, 1):
+		r.Header().Set("Connection", "keep-alive")
+	}
+
+	// Content-Type(defaults to text/plain), only for responses
+	// that can have a body
+	if v := r.Header().Get("Content-Type"); len(v) == 0 && BodyAllowedForStatus(r.status) {
+		r.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+}
+
+// reset drops everything the handler set, so a different
+// response can be sent instead. Only valid before the headers
+// are sent.
+func (r *response) reset() {
+	r.header = make(Header)
+	r.wroteHeader = false
+	r.status = 0
+	r.body = nil
+	r.chunking = false
+	r.contentLength = -1
+	r.written = 0
+}
+
+func (r *response) flush() error {
+	return r.w.Flush()
+}
+
+func (r *response) SetNotfoundHeader() {
+	r.WriteHeader(StatusNotFound)
+}
+
+func (r *response) SetInternalServerErrHeader() {
+	r.WriteHeader(StatusInternalServerError)
+}
+
+func (r *response) SetBadRequestHeader() {
+	r.WriteHeader(StatusBadRequest)
+}
@@ -0,0 +1,298 @@
+package httpcore
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestResponse returns a response for req whose output is
+// collected in the returned buffer.
+func newTestResponse(req *Request) (*response, *bytes.Buffer) {
+	var buf bytes.Buffer
+
+	if req.Header == nil {
+		req.Header = make(Header)
+	}
+
+	res := &response{
+		req:           req,
+		header:        make(Header),
+		contentLength: -1,
+		w:             bufio.NewWriter(&buf),
+	}
+
+	return res, &buf
+}
+
+func TestResponseBufferedBodyGetsContentLength(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+
+	res.Write([]byte("OK"))
+	res.finalizeResponse()
+
+	got := out.String()
+
+	if !strings.Contains(got, "Content-Length: 2\r\n") {
+		t.Fatalf("Expected Content-Length: 2 in %q", got)
+	}
+
+	if !strings.HasSuffix(got, "\r\n\r\nOK") {
+		t.Fatalf("Expected body after headers in %q", got)
+	}
+}
+
+func TestResponseLargeBodyIsChunked(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+
+	chunk := strings.Repeat("a", bufferBeforeChunkingSize)
+	res.Write([]byte(chunk))
+	res.Write([]byte("b"))
+	res.finalizeResponse()
+
+	got := out.String()
+
+	if !strings.Contains(got, "Transfer-Encoding: chunked\r\n") {
+		t.Fatalf("Expected chunked response, got headers %q", got[:strings.Index(got, "\r\n\r\n")])
+	}
+
+	if strings.Contains(got, "Content-Length") {
+		t.Fatalf("Chunked response must not have a Content-Length")
+	}
+
+	if !strings.HasSuffix(got, "1001\r\n"+chunk+"b\r\n0\r\n\r\n") {
+		t.Fatalf("Unexpected chunked body framing")
+	}
+}
+
+func TestResponseLargeBodyHTTP10IsCloseDelimited(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 0})
+
+	body := strings.Repeat("a", bufferBeforeChunkingSize+1)
+	res.Write([]byte(body))
+	res.finalizeResponse()
+
+	got := out.String()
+
+	if strings.Contains(got, "Transfer-Encoding") || strings.Contains(got, "Content-Length") {
+		t.Fatalf("Expected a close-delimited body, got headers %q", got[:strings.Index(got, "\r\n\r\n")])
+	}
+
+	if !strings.HasSuffix(got, "\r\n\r\n"+body) {
+		t.Fatalf("Unexpected body")
+	}
+}
+
+func TestResponseHeadHasLengthButNoBody(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodHead, ProtocolMajor: 1, ProtocolMinor: 1})
+
+	res.Write([]byte(strings.Repeat("a", bufferBeforeChunkingSize*2)))
+	res.finalizeResponse()
+
+	got := out.String()
+
+	if !strings.Contains(got, "Content-Length: 8192\r\n") {
+		t.Fatalf("Expected the GET Content-Length, got %q", got)
+	}
+
+	if !strings.HasSuffix(got, "\r\n\r\n") {
+		t.Fatalf("Expected no body after the headers, got %q", got)
+	}
+}
+
+func TestResponseFlushStreamsChunks(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+
+	res.Write([]byte("first"))
+	if err := res.Flush(); err != nil {
+		t.Fatalf("Flush: %s", err)
+	}
+
+	got := out.String()
+	if !strings.Contains(got, "Transfer-Encoding: chunked\r\n") || !strings.HasSuffix(got, "\r\n\r\n5\r\nfirst\r\n") {
+		t.Fatalf("Expected headers and the first chunk on the wire, got %q", got)
+	}
+
+	res.Write([]byte("second"))
+	res.Flush()
+
+	if !strings.HasSuffix(out.String(), "5\r\nfirst\r\n6\r\nsecond\r\n") {
+		t.Fatalf("Expected the second chunk right after the first, got %q", out.String())
+	}
+
+	res.finalizeResponse()
+
+	if !strings.HasSuffix(out.String(), "6\r\nsecond\r\n0\r\n\r\n") {
+		t.Fatalf("Expected the last chunk, got %q", out.String())
+	}
+}
+
+func TestResponseFlushKeepsDeclaredContentLength(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+
+	res.Header().Set("Content-Length", "10")
+	res.Write([]byte("hello"))
+	res.Flush()
+	res.Write([]byte("world"))
+	res.finalizeResponse()
+
+	got := out.String()
+
+	if strings.Contains(got, "Transfer-Encoding") || !strings.Contains(got, "Content-Length: 10\r\n") {
+		t.Fatalf("Expected the declared Content-Length, got %q", got)
+	}
+
+	if !strings.HasSuffix(got, "\r\n\r\nhelloworld") {
+		t.Fatalf("Expected an unframed body, got %q", got)
+	}
+}
+
+func TestResponseDeclaredContentLengthMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		declared int
+		writes   []int
+		body     int  // bytes on the wire
+		rejected bool // a write failed with ErrContentLength
+	}{
+		{"longer, buffered", 10, []int{20}, 0, true},
+		{"longer, over the buffer", 10, []int{5000}, 0, true},
+		{"longer, after streaming", 5000, []int{4500, 1000}, 4500, true},
+		{"shorter, buffered", 10, []int{5}, 5, false},
+		{"shorter, over the buffer", 5000, []int{4500}, 4500, false},
+	} {
+		res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+		res.wantKeepAlive = true
+
+		res.Header().Set("Content-Length", strconv.Itoa(tc.declared))
+
+		rejected := false
+		for _, n := range tc.writes {
+			if _, err := res.Write([]byte(strings.Repeat("a", n))); err == ErrContentLength {
+				rejected = true
+			}
+		}
+
+		res.finalizeResponse()
+
+		got := out.String()
+		head, body, _ := strings.Cut(got, "\r\n\r\n")
+
+		if rejected != tc.rejected {
+			t.Errorf("%s: ErrContentLength returned: %v, want %v", tc.name, rejected, tc.rejected)
+		}
+
+		if !strings.Contains(head+"\r\n", "Content-Length: "+strconv.Itoa(tc.declared)+"\r\n") || len(body) != tc.body {
+			t.Errorf("%s: got Content-Length header in %q and %d body bytes, want %d and %d", tc.name, head, len(body), tc.declared, tc.body)
+		}
+
+		// The body is short, only closing the connection ends it
+		if !res.closeAfterReply {
+			t.Errorf("%s: expected the connection to be closed after the response", tc.name)
+		}
+	}
+}
+
+func TestResponseFlushHTTP10IsCloseDelimited(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 0})
+	res.wantKeepAlive = true
+
+	res.Write([]byte("data"))
+	res.Flush()
+
+	got := out.String()
+
+	if !strings.Contains(got, "Connection: close\r\n") || !strings.HasSuffix(got, "\r\n\r\ndata") {
+		t.Fatalf("Expected a close-delimited body, got %q", got)
+	}
+
+	if !res.closeAfterReply {
+		t.Fatalf("Expected the connection to be closed after the response")
+	}
+}
+
+func TestResponseWithoutBodyStatus(t *testing.T) {
+	for _, code := range []int{StatusSwitchingProtocols, StatusNoContent, StatusNotModified} {
+		res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+
+		res.WriteHeader(code)
+		if _, err := res.Write([]byte("ignored")); err != ErrBodyNotAllowed {
+			t.Fatalf("%d: expected ErrBodyNotAllowed, got %v", code, err)
+		}
+		res.finalizeResponse()
+
+		got := out.String()
+
+		if strings.Contains(got, "Content-Length") || strings.Contains(got, "Transfer-Encoding") ||
+			strings.Contains(got, "Content-Type") {
+			t.Fatalf("%d: expected no body headers, got %q", code, got)
+		}
+
+		if !strings.HasPrefix(got, "HTTP/1.1 "+strconv.Itoa(code)+" "+StatusText(code)+"\r\n") || !strings.HasSuffix(got, "\r\n\r\n") {
+			t.Fatalf("%d: expected a bodiless response, got %q", code, got)
+		}
+	}
+}
+
+func TestResponseReasonPhrase(t *testing.T) {
+	res, out := newTestResponse(&Request{Method: MethodPost, ProtocolMajor: 1, ProtocolMinor: 1})
+
+	res.WriteHeader(StatusCreated)
+	res.finalizeResponse()
+
+	if !strings.HasPrefix(out.String(), "HTTP/1.1 201 Created\r\n") {
+		t.Fatalf("Expected a 201 Created status line, got %q", out.String())
+	}
+}
+
+func TestNewResponseSwitchingProtocols(t *testing.T) {
+	var buf bytes.Buffer
+
+	res := NewResponse(&buf, nil)
+	res.Header().Set("Connection", "Upgrade")
+	res.Header().Set("Upgrade", "websocket")
+	res.WriteHeader(StatusSwitchingProtocols)
+	res.FinalizeResponse()
+
+	got := buf.String()
+
+	if !strings.HasPrefix(got, "HTTP/1.1 101 Switching Protocols\r\n") || !strings.Contains(got, "Connection: Upgrade\r\n") {
+		t.Fatalf("Expected a 101 keeping Connection: Upgrade, got %q", got)
+	}
+}
+
+func TestResponseInvalidHeaderSends500(t *testing.T) {
+	for name, set := range map[string]func(Header){
+		"CRLF in value":    func(h Header) { h.Set("X-User", "bob\r\nSet-Cookie: admin=1") },
+		"NUL in value":     func(h Header) { h.Set("X-User", "bob\x00") },
+		"space in name":    func(h Header) { h["X User"] = []string{"bob"} },
+		"bad length value": func(h Header) { h.Set("Content-Length", "12abc") },
+	} {
+		res, out := newTestResponse(&Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1})
+		res.wantKeepAlive = true
+
+		set(res.Header())
+		res.Write([]byte("hello"))
+
+		if err := res.Flush(); err == nil {
+			t.Errorf("%s: expected Flush to fail", name)
+		}
+
+		if _, err := res.Write([]byte("more")); err == nil {
+			t.Errorf("%s: expected writes after the failure to fail", name)
+		}
+
+		res.finalizeResponse()
+
+		want := "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
+		if got := out.String(); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+
+		if !res.closeAfterReply {
+			t.Errorf("%s: expected the connection to be closed", name)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package httpcore
+
+import (
+	"bufio"
+	"errors"
+	"net"
+)
+
+type ResponseWriter interface {
+	// It returns the header map that will be sent by [ResponseWriter.WriteHeader].
+	Header() Header
+
+	// Write writes the data to the connection as part of an HTTP reply
+	Write([]byte) (int, error)
+
+	// WriteHeader sends an HTTP response header with the provided status code
+	//
+	// If WriteHeader is not called explicitly, the first call to Writewill trigger
+	// an implicit WriteHeader(StatusOK)
+	WriteHeader(statusCode int)
+}
+
+// Flusher is implemented by ResponseWriters that can send buffered
+// data to the client before the handler returns.
+//
+// The first Flush commits the status line and the headers. When the
+// handler did not set a Content-Length, the body is then chunked for
+// HTTP/1.1 clients and delimited by closing the connection for
+// HTTP/1.0 ones.
+//
+// A handler reaches it with a type assertion:
+//
+//	if f, ok := w.(Flusher); ok {
+//		f.Flush()
+//	}
+type Flusher interface {
+	// Flush sends any buffered data to the client. It returns an
+	// error once the client can no longer be written to.
+	Flush() error
+}
+
+var ErrHijacked = errors.New("connection has been hijacked")
+var ErrNotHijackable = errors.New("response is not tied to a server connection")
+
+// Hijacker is implemented by ResponseWriters that let a handler take
+// over the connection, e.g. to speak WebSocket or tunnel a CONNECT.
+type Hijacker interface {
+	// Hijack hands the connection over to the caller, who must close
+	// it. The server stops serving it once the handler returns.
+	//
+	// The returned reader holds the bytes the client already sent
+	// past the request head (pipelined data or the first frames of
+	// the new protocol), so it must be read instead of the conn.
+	//
+	// A response that was not sent yet is dropped; after Hijack the
+	// ResponseWriter returns ErrHijacked.
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+}
@@ -0,0 +1,361 @@
+package httpcore
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Router dispatches requests to handlers by method and path.
+//
+// Patterns have the form "[METHOD ]/path", e.g. "GET /users/{id}".
+// Without a method the route matches every method.
+//
+// A path segment is either
+//   - a literal ("users"), matched exactly
+//   - a parameter ("{id}"), matching any single segment
+//   - a catch-all ("{path...}"), matching the rest of the path. It
+//     must be the last segment.
+//
+// Literal segments win over parameters, which win over catch-alls.
+// Matched values are available through [Request.PathValue].
+//
+// Routes match the decoded, normalized URL.Path. CONNECT requests
+// carry no path (authority-form) and are matched against "/".
+type Router struct {
+	root *node
+
+	middlewares []Middleware
+
+	handler Handler // dispatch wrapped by the middlewares
+}
+
+// node is one path segment in the routing trie.
+type node struct {
+	children map[string]*node // literal segments
+
+	param *node // "{name}" child
+
+	catchAll *node // "{name...}" child
+
+	name string // parameter name, for param and catchAll nodes
+
+	handlers map[string]Handler // by method, "" matches any method
+}
+
+func newNode() *node {
+	return &node{
+		children: make(map[string]*node),
+		handlers: make(map[string]Handler),
+	}
+}
+
+func NewRouter() *Router {
+	r := &Router{
+		root: newNode(),
+	}
+
+	r.handler = HandlerFunc(r.dispatch)
+
+	return r
+}
+
+// Use adds middlewares that wrap every request routed by r,
+// including the ones answered with 404 or 405.
+//
+// Middlewares run in the order they were added.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.handler = Chain(HandlerFunc(r.dispatch), r.middlewares...)
+}
+
+// HandleRoute registers the handler function for pattern.
+func (r *Router) HandleRoute(pattern string, handler HandlerFunc) {
+	r.Handle(pattern, handler)
+}
+
+// Handle registers handler for pattern.
+//
+// It panics if the pattern is malformed or was already registered
+// for the same method.
+func (r *Router) Handle(pattern string, handler Handler) {
+	method, path := parsePattern(pattern)
+
+	n := r.root
+
+	segments := splitPath(path)
+	for i, seg := range segments {
+		name, isParam, isCatchAll := parseSegment(pattern, seg)
+
+		switch {
+		case isCatchAll:
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("router: catch-all must be the last segment in %q", pattern))
+			}
+
+			n.catchAll = n.child(n.catchAll, name, pattern)
+			n = n.catchAll
+
+		case isParam:
+			n.param = n.child(n.param, name, pattern)
+			n = n.param
+
+		default:
+			if _, ok := n.children[seg]; !ok {
+				n.children[seg] = newNode()
+			}
+			n = n.children[seg]
+		}
+	}
+
+	if _, ok := n.handlers[method]; ok {
+		panic(fmt.Sprintf("router: pattern %q registered twice", pattern))
+	}
+
+	n.handlers[method] = handler
+}
+
+// child returns the existing parameter node c, or a new one named
+// name. Two routes can't name the same parameter differently.
+func (n *node) child(c *node, name, pattern string) *node {
+	if c == nil {
+		c = newNode()
+		c.name = name
+	}
+
+	if c.name != name {
+		panic(fmt.Sprintf("router: parameter {%s} in %q conflicts with {%s}", name, pattern, c.name))
+	}
+
+	return c
+}
+
+// ServeHTTP runs the request through the middlewares and routes it.
+func (r *Router) ServeHTTP(w ResponseWriter, req *Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// dispatch routes the request to its handler.
+//
+// It replies 404 Not Found if no route matches the path and
+// 405 Method Not Allowed (with an Allow header) if routes match
+// the path but not the method.
+//
+// HEAD requests fall back to the GET route. OPTIONS requests
+// without an OPTIONS route are answered with the Allow header of
+// the path, or of the whole router for "OPTIONS *".
+func (r *Router) dispatch(w ResponseWriter, req *Request) {
+	if req.Method == MethodOptions && req.URL.Path == "*" {
+		r.serveOptions(w, r.root.allMethods(nil))
+		return
+	}
+
+	segments := splitPath(req.URL.Path)
+
+	var params []string
+	if n := r.root.match(segments, req.Method, &params); n != nil {
+		req.pathParams = make(map[string]string, len(params)/2)
+		for i := 0; i < len(params); i += 2 {
+			req.pathParams[params[i]] = params[i+1]
+		}
+
+		n.handler(req.Method).ServeHTTP(w, req)
+		return
+	}
+
+	allowed := r.root.allowed(segments, nil)
+	if len(allowed) == 0 {
+		// No route registered for this path
+		w.WriteHeader(StatusNotFound)
+		return
+	}
+
+	if req.Method == MethodOptions {
+		r.serveOptions(w, allowed)
+		return
+	}
+
+	w.Header().Set("Allow", allowHeader(allowed))
+	w.WriteHeader(StatusMethodNotAllowed)
+}
+
+// serveOptions answers an OPTIONS request with the allowed methods.
+func (r *Router) serveOptions(w ResponseWriter, allowed []string) {
+	w.Header().Set("Allow", allowHeader(append(allowed, MethodOptions)))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(StatusOK)
+}
+
+// allowHeader formats methods for the Allow header.
+//
+// A method-less route ("") allows every method, and GET implies HEAD.
+func allowHeader(methods []string) string {
+	var out []string
+
+	for _, m := range methods {
+		switch m {
+		case "":
+			out = append(out, MethodGet, MethodHead, MethodPost, MethodPut, MethodPatch,
+				MethodDelete, MethodConnect, MethodOptions, MethodTrace)
+		case MethodGet:
+			out = append(out, MethodGet, MethodHead)
+		default:
+			out = append(out, m)
+		}
+	}
+
+	slices.Sort(out)
+
+	return strings.Join(slices.Compact(out), ", ")
+}
+
+// match finds the node for segments that has a handler for method.
+//
+// Matched parameters are appended to params as name, value pairs.
+func (n *node) match(segments []string, method string, params *[]string) *node {
+	if len(segments) == 0 {
+		if n.handler(method) != nil {
+			return n
+		}
+		return nil
+	}
+
+	seg, rest := segments[0], segments[1:]
+
+	if c, ok := n.children[seg]; ok {
+		if m := c.match(rest, method, params); m != nil {
+			return m
+		}
+	}
+
+	if n.param != nil && len(seg) > 0 {
+		*params = append(*params, n.param.name, seg)
+
+		if m := n.param.match(rest, method, params); m != nil {
+			return m
+		}
+
+		*params = (*params)[:len(*params)-2]
+	}
+
+	if n.catchAll != nil && n.catchAll.handler(method) != nil {
+		*params = append(*params, n.catchAll.name, strings.Join(segments, "/"))
+
+		return n.catchAll
+	}
+
+	return nil
+}
+
+// allowed collects the methods of every route matching segments.
+func (n *node) allowed(segments []string, methods []string) []string {
+	if len(segments) == 0 {
+		for m := range n.handlers {
+			methods = append(methods, m)
+		}
+		return methods
+	}
+
+	seg, rest := segments[0], segments[1:]
+
+	if c, ok := n.children[seg]; ok {
+		methods = c.allowed(rest, methods)
+	}
+
+	if n.param != nil && len(seg) > 0 {
+		methods = n.param.allowed(rest, methods)
+	}
+
+	if n.catchAll != nil {
+		for m := range n.catchAll.handlers {
+			methods = append(methods, m)
+		}
+	}
+
+	return methods
+}
+
+// allMethods collects the methods of every route in the trie.
+func (n *node) allMethods(methods []string) []string {
+	for m := range n.handlers {
+		methods = append(methods, m)
+	}
+
+	for _, c := range n.children {
+		methods = c.allMethods(methods)
+	}
+
+	if n.param != nil {
+		methods = n.param.allMethods(methods)
+	}
+
+	if n.catchAll != nil {
+		methods = n.catchAll.allMethods(methods)
+	}
+
+	return methods
+}
+
+// handler returns the handler registered for method, falling back
+// to the GET route for HEAD and then to a method-less route.
+func (n *node) handler(method string) Handler {
+	if h, ok := n.handlers[method]; ok {
+		return h
+	}
+
+	if h, ok := n.handlers[MethodGet]; ok && method == MethodHead {
+		return h
+	}
+
+	return n.handlers[""]
+}
+
+// parsePattern splits "[METHOD ]/path" into its method and path.
+func parsePattern(pattern string) (method, path string) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+
+	path = strings.TrimLeft(path, " \t")
+
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("router: pattern %q must begin with '/'", pattern))
+	}
+
+	return method, path
+}
+
+// parseSegment tells literal, "{name}" and "{name...}" segments apart.
+func parseSegment(pattern, seg string) (name string, isParam, isCatchAll bool) {
+	if !strings.ContainsAny(seg, "{}") {
+		return "", false, false
+	}
+
+	if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+		panic(fmt.Sprintf("router: bad segment %q in %q", seg, pattern))
+	}
+
+	name = seg[1 : len(seg)-1]
+
+	name, isCatchAll = strings.CutSuffix(name, "...")
+
+	if len(name) == 0 || strings.ContainsAny(name, "{}") {
+		panic(fmt.Sprintf("router: bad segment %q in %q", seg, pattern))
+	}
+
+	return name, !isCatchAll, isCatchAll
+}
+
+// splitPath splits a path into its segments.
+//
+// "/" has no segments, and a trailing slash gives an empty last
+// segment, so "/users" and "/users/" are different routes.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if len(path) == 0 {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,156 @@
+package httpcore
+
+import (
+	"testing"
+)
+
+// routeTestRequest routes a request for method and path through
+// router and returns the response.
+func routeTestRequest(router *Router, method, path string) *response {
+	res, _ := newTestResponse(&Request{Method: method, URL: &URL{Path: path}})
+
+	router.ServeHTTP(res, res.req)
+
+	return res
+}
+
+func TestRouterPathParams(t *testing.T) {
+	router := NewRouter()
+
+	var got string
+	router.HandleRoute("GET /users/{id}/posts/{post}", func(w ResponseWriter, r *Request) {
+		got = r.PathValue("id") + ":" + r.PathValue("post")
+	})
+
+	routeTestRequest(router, MethodGet, "/users/42/posts/7")
+
+	if got != "42:7" {
+		t.Fatalf("Expected path values 42:7, got %q", got)
+	}
+}
+
+func TestRouterPrefersLiteralSegments(t *testing.T) {
+	router := NewRouter()
+
+	var got string
+	router.HandleRoute("GET /users/{id}", func(w ResponseWriter, r *Request) { got = "param" })
+	router.HandleRoute("GET /users/me", func(w ResponseWriter, r *Request) { got = "literal" })
+	router.HandleRoute("GET /users/{path...}", func(w ResponseWriter, r *Request) { got = "catch-all" })
+
+	for path, want := range map[string]string{
+		"/users/me":       "literal",
+		"/users/42":       "param",
+		"/users/42/posts": "catch-all",
+	} {
+		got = ""
+		routeTestRequest(router, MethodGet, path)
+
+		if got != want {
+			t.Fatalf("%s: expected %s route, got %q", path, want, got)
+		}
+	}
+}
+
+func TestRouterCatchAll(t *testing.T) {
+	router := NewRouter()
+
+	var got string
+	router.HandleRoute("GET /static/{file...}", func(w ResponseWriter, r *Request) {
+		got = r.PathValue("file")
+	})
+
+	routeTestRequest(router, MethodGet, "/static/css/site.css")
+
+	if got != "css/site.css" {
+		t.Fatalf("Expected catch-all value css/site.css, got %q", got)
+	}
+
+	if res := routeTestRequest(router, MethodGet, "/static"); res.status != StatusNotFound {
+		t.Fatalf("Expected 404 for /static, got %d", res.status)
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+
+	router.HandleRoute("GET /users/{id}", func(w ResponseWriter, r *Request) {})
+	router.HandleRoute("DELETE /users/{id}", func(w ResponseWriter, r *Request) {})
+
+	res := routeTestRequest(router, MethodPost, "/users/42")
+
+	if res.status != StatusMethodNotAllowed {
+		t.Fatalf("Expected 405, got %d", res.status)
+	}
+
+	if allow := res.Header().Get("Allow"); allow != "DELETE, GET, HEAD" {
+		t.Fatalf("Expected Allow: DELETE, GET, HEAD, got %q", allow)
+	}
+}
+
+func TestRouterHeadFallsBackToGet(t *testing.T) {
+	router := NewRouter()
+
+	called := false
+	router.HandleRoute("GET /health", func(w ResponseWriter, r *Request) { called = true })
+
+	routeTestRequest(router, MethodHead, "/health")
+
+	if !called {
+		t.Fatalf("Expected the GET route to serve HEAD")
+	}
+}
+
+func TestRouterAutomaticOptions(t *testing.T) {
+	router := NewRouter()
+
+	router.HandleRoute("GET /users/{id}", func(w ResponseWriter, r *Request) {})
+	router.HandleRoute("PUT /users/{id}", func(w ResponseWriter, r *Request) {})
+	router.HandleRoute("POST /posts", func(w ResponseWriter, r *Request) {})
+
+	res := routeTestRequest(router, MethodOptions, "/users/42")
+	if res.status != StatusOK {
+		t.Fatalf("Expected 200, got %d", res.status)
+	}
+
+	if allow := res.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("Expected Allow: GET, HEAD, OPTIONS, PUT, got %q", allow)
+	}
+
+	res = routeTestRequest(router, MethodOptions, "*")
+	if allow := res.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST, PUT" {
+		t.Fatalf("Expected Allow: GET, HEAD, OPTIONS, POST, PUT, got %q", allow)
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	router := NewRouter()
+
+	router.HandleRoute("GET /users/{id}", func(w ResponseWriter, r *Request) {})
+
+	if res := routeTestRequest(router, MethodGet, "/posts/42"); res.status != StatusNotFound {
+		t.Fatalf("Expected 404, got %d", res.status)
+	}
+}
+
+func TestRouterConflictingPatternsPanic(t *testing.T) {
+	for _, patterns := range [][2]string{
+		{"GET /users/{id}", "GET /users/{id}"},
+		{"GET /users/{id}", "POST /users/{name}"},
+		{"GET /files/{path...}/x", ""},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Expected %q to panic", patterns)
+				}
+			}()
+
+			router := NewRouter()
+			for _, p := range patterns {
+				if len(p) > 0 {
+					router.HandleRoute(p, func(w ResponseWriter, r *Request) {})
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,465 @@
+// Package httpcore is an HTTP/1.x server built directly on net,
+// without net/http.
+//
+// A Server accepts connections and hands every request to a Handler,
+// usually a Router:
+//
+//	router := httpcore.NewRouter()
+//	router.HandleRoute("GET /users/{id}", func(w httpcore.ResponseWriter, r *httpcore.Request) {
+//		w.Write([]byte("user " + r.PathValue("id")))
+//	})
+//
+//	s := &httpcore.Server{Addr: ":8080", Handler: router}
+//	s.ListenAndServe()
+//
+// ListenAndServeTLS serves HTTPS instead; tlsutil can generate a
+// self-signed certificate for local development.
+//
+// Handlers that take the connection over (like the WebSocket
+// server's) use Hijacker, and NewResponse to answer on it.
+package httpcore
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after
+// Shutdown or Close.
+var ErrServerClosed = errors.New("Server closed")
+
+// shutdownPollInterval is how often Shutdown checks whether the
+// remaining connections went idle.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// maxAcceptDelay caps the back-off between failed Accepts.
+const maxAcceptDelay = time.Second
+
+// Server serves HTTP/1.x requests on the connections it accepts.
+type Server struct {
+	// Addr Specifies the TCP address for the server to listen on,
+	// in form "host:port".
+	Addr string
+
+	// MaxBodyBytes limits the size of request bodies. Requests that
+	// declare a larger body are answered with 413 Payload Too Large.
+	//
+	// If zero, DefaultMaxBodyBytes is used.
+	MaxBodyBytes int64
+
+	// MaxHeaderBytes limits the size of the request line and header
+	// section. Longer request lines are answered with 414 URI Too
+	// Long, larger header sections with 431 Request Header Fields Too
+	// Large.
+	//
+	// If zero, DefaultMaxHeaderBytes is used.
+	MaxHeaderBytes int
+
+	// MaxHeaderFields limits the number of header fields of a request,
+	// more are answered with 431 Request Header Fields Too Large.
+	//
+	// If zero, DefaultMaxHeaderFields is used.
+	MaxHeaderFields int
+
+	// ReadHeaderTimeout is how long a client may take to send the
+	// request line and headers, counted from their first byte. Clients
+	// that are slower (e.g. trickling one byte at a time) get 408
+	// Request Timeout.
+	//
+	// If zero, ReadTimeout is used, and if that is zero as well,
+	// DefaultReadHeaderTimeout.
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout is how long reading a whole request, body included,
+	// may take. Body reads past it fail with ErrReadBodyTimeout.
+	//
+	// If zero, the body may take any time.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is how long writing a response may take, counted
+	// from the end of the request headers. Writes past it fail with
+	// ErrWriteTimeout and the connection is closed.
+	//
+	// If zero, there is no limit.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is how long a keep-alive connection may wait for
+	// the next request before it is closed.
+	//
+	// If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// MaxRequestsPerConn limits how many requests are served on a
+	// single connection. The last response carries "Connection: close".
+	//
+	// If zero, there is no limit.
+	MaxRequestsPerConn int
+
+	// TLSConfig configures the connections served by ListenAndServeTLS
+	// and ServeTLS. It is cloned, never modified.
+	//
+	// If nil, TLS 1.2 or newer is required.
+	TLSConfig *tls.Config
+
+	// Handler answers every request, usually a *Router.
+	//
+	// If nil, every request gets 404 Not Found.
+	Handler Handler
+
+	middlewares []Middleware
+
+	inShutdown atomic.Bool
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	conns      map[*conn]struct{}
+	onShutdown []func()
+}
+
+var CRLF = []byte("\r\n")
+
+// ListenAndServe listens on s.Addr and serves plain HTTP on the
+// accepted connections.
+func (s *Server) ListenAndServe() error {
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("server started listening", slog.String("addr", ln.Addr().String()))
+	return s.Serve(ln)
+}
+
+// ListenAndServeTLS is like ListenAndServe but serves HTTPS.
+//
+// certFile and keyFile hold a PEM encoded certificate and its private
+// key. They may be empty if s.TLSConfig already has a certificate.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("server started listening (TLS)", slog.String("addr", ln.Addr().String()))
+	return s.ServeTLS(ln, certFile, keyFile)
+}
+
+// ServeTLS serves HTTPS on the connections accepted by ln, see
+// ListenAndServeTLS for certFile and keyFile.
+func (s *Server) ServeTLS(ln net.Listener, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	return s.Serve(tls.NewListener(ln, config))
+}
+
+// tlsConfig returns a copy of s.TLSConfig holding the certificate in
+// certFile and keyFile.
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	hasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
+
+	if len(certFile) > 0 || len(keyFile) > 0 || !hasCert {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = append([]tls.Certificate{cert}, config.Certificates...)
+	}
+
+	return config, nil
+}
+
+// Serve accepts connections on ln and serves each of them on its
+// own goroutine. It always returns an error, ErrServerClosed after
+// Shutdown or Close.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.trackListener(ln, true) {
+		ln.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(ln, false)
+
+	var delay time.Duration
+
+	// Accept active connections
+	for {
+		rwc, err := ln.Accept()
+
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			// Probably out of file descriptors, back off instead of
+			// spinning until some are released
+			delay = min(max(2*delay, 5*time.Millisecond), maxAcceptDelay)
+
+			slog.Error("error accepting client connection",
+				slog.String("err", err.Error()),
+				slog.Duration("retrying in", delay),
+			)
+			time.Sleep(delay)
+
+			continue
+		}
+
+		delay = 0
+
+		slog.Info(fmt.Sprintf("client connected: %s\n", rwc.RemoteAddr()))
+
+		c := s.newConn(rwc)
+		s.trackConn(c, true)
+
+		go c.serve()
+	}
+}
+
+// Shutdown stops the server gracefully: it closes the listeners,
+// then waits for the requests being served to finish and closes the
+// connections as they go idle.
+//
+// If ctx expires first, Shutdown returns its error and the remaining
+// connections are left open; call Close to drop them.
+//
+// Hijacked connections are not tracked, use RegisterOnShutdown to
+// close them.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	err := s.closeListeners()
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the listeners and every connection right away,
+// cutting off the requests being served. For a graceful shutdown
+// use Shutdown.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.closeListeners()
+
+	for c := range s.conns {
+		c.rwc.Close()
+		delete(s.conns, c)
+	}
+
+	return err
+}
+
+// RegisterOnShutdown registers f to be called, on its own goroutine,
+// when Shutdown starts. Handlers that hijacked connections use it to
+// close them.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	s.onShutdown = append(s.onShutdown, f)
+	s.mu.Unlock()
+}
+
+func (s *Server) shuttingDown() bool {
+	return s.inShutdown.Load()
+}
+
+// trackListener adds or removes ln from the listeners closed on
+// shutdown. It reports false if the server is already shutting down.
+func (s *Server) trackListener(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, ln)
+		return true
+	}
+
+	if s.shuttingDown() {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[ln] = struct{}{}
+
+	return true
+}
+
+// closeListeners must be called with s.mu held.
+func (s *Server) closeListeners() error {
+	var err error
+
+	for ln := range s.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.listeners, ln)
+	}
+
+	return err
+}
+
+func (s *Server) trackConn(c *conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, c)
+		return
+	}
+
+	if s.conns == nil {
+		s.conns = make(map[*conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+}
+
+// closeIdleConns closes the connections waiting for their next
+// request and reports whether none are left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		if c.idle.Load() {
+			c.rwc.Close()
+			delete(s.conns, c)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+func (s *Server) requestLimits() requestLimits {
+	limits := requestLimits{
+		maxHeaderBytes:  s.MaxHeaderBytes,
+		maxHeaderFields: s.MaxHeaderFields,
+		maxBodyBytes:    s.maxBodyBytes(),
+	}
+
+	if limits.maxHeaderBytes <= 0 {
+		limits.maxHeaderBytes = DefaultMaxHeaderBytes
+	}
+
+	if limits.maxHeaderFields <= 0 {
+		limits.maxHeaderFields = DefaultMaxHeaderFields
+	}
+
+	return limits
+}
+
+func (s *Server) maxBodyBytes() int64 {
+	if s.MaxBodyBytes > 0 {
+		return s.MaxBodyBytes
+	}
+
+	return DefaultMaxBodyBytes
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
+	}
+
+	if s.ReadTimeout > 0 {
+		return s.ReadTimeout
+	}
+
+	return DefaultReadHeaderTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+
+	return DefaultIdleTimeout
+}
+
+// Use adds middlewares that wrap s.Handler for every request.
+//
+// It must be called before the server starts serving.
+func (s *Server) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// handler returns s.Handler wrapped by the server's middlewares
+func (s *Server) handler() Handler {
+	var h Handler = HandlerFunc(NotFound)
+
+	if s.Handler != nil {
+		h = s.Handler
+	}
+
+	return Chain(h, s.middlewares...)
+}
+
+// A Handler responds to an HTTP request.
+type Handler interface {
+	ServeHTTP(ResponseWriter, *Request)
+}
+
+// HandlerFunc lets an ordinary function be used as a Handler.
+type HandlerFunc func(ResponseWriter, *Request)
+
+// ServeHTTP calls f(w, r)
+func (f HandlerFunc) ServeHTTP(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// NotFound replies with 404 Not Found.
+func NotFound(w ResponseWriter, r *Request) {
+	w.WriteHeader(StatusNotFound)
+}
+
+func ListenAndServe(addr string) (*Server, error) {
+	server := &Server{Addr: addr, Handler: NewRouter()}
+	return server, server.ListenAndServe()
+}
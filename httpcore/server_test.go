@@ -0,0 +1,226 @@
+package httpcore
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suman7383/networking-from-scratch/tlsutil"
+)
+
+func TestServeTLS(t *testing.T) {
+	cert, err := tlsutil.SelfSignedCertificate("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer()
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	go s.ServeTLS(ln, "", "")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /health HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"))
+
+	head, body := readTestResponse(t, bufio.NewReader(conn))
+	if !strings.HasPrefix(head, "HTTP/1.1 200 OK\r\n") || body != "OK" {
+		t.Errorf("got %q %q", head, body)
+	}
+}
+
+func TestServeTLSWithoutCertificate(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer()
+
+	if err := s.ServeTLS(ln, "", ""); err == nil {
+		t.Fatal("ServeTLS without a certificate should fail")
+	}
+
+	// The listener was closed
+	if _, err := ln.Accept(); err == nil {
+		t.Error("listener still accepting")
+	}
+}
+
+// startTestServer serves s on a local port and returns the address
+// and the error Serve returned, once it does.
+func startTestServer(t *testing.T, s *Server) (addr string, served <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Serve(ln)
+	}()
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return ln.Addr().String(), errc
+}
+
+func TestShutdownWaitsForActiveRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	router := NewRouter()
+	router.HandleRoute("/slow", func(w ResponseWriter, r *Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	s := &Server{Handler: router}
+	addr, served := startTestServer(t, s)
+
+	// One connection busy with a request, one idle
+	busy, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	busy.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+
+	// The idle connection is closed without a response
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := idle.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Errorf("idle connection: read %d bytes, err %v", n, err)
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the request finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	head, body := readTestResponse(t, bufio.NewReader(busy))
+	if !strings.Contains(head, "Connection: close\r\n") || body != "done" {
+		t.Errorf("got %q %q", head, body)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown returned %v", err)
+	}
+
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("server still accepting connections")
+	}
+}
+
+func TestShutdownContextExpires(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+
+	router := NewRouter()
+	router.HandleRoute("/stuck", func(w ResponseWriter, r *Request) {
+		close(started)
+		<-release
+	})
+
+	s := &Server{Handler: router}
+	addr, _ := startTestServer(t, s)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /stuck HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown returned %v, want context.DeadlineExceeded", err)
+	}
+
+	// Close drops the request still being served
+	s.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Errorf("read %d bytes, err %v after Close", n, err)
+	}
+}
+
+func TestServeAfterShutdown(t *testing.T) {
+	s := newTestServer()
+	s.Shutdown(context.Background())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Serve(ln); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+}
+
+func TestRegisterOnShutdown(t *testing.T) {
+	s := newTestServer()
+
+	called := make(chan struct{})
+	s.RegisterOnShutdown(func() {
+		close(called)
+	})
+
+	s.Shutdown(context.Background())
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Error("shutdown hook was not called")
+	}
+}
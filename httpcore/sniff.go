@@ -0,0 +1,137 @@
+package httpcore
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how many bytes DetectContentType looks at.
+const sniffLen = 512
+
+// signature is a byte prefix that identifies a content type.
+type signature struct {
+	prefix      []byte
+	contentType string
+}
+
+var signatures = []signature{
+	{[]byte("%PDF-"), "application/pdf"},
+	{[]byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{[]byte("GIF87a"), "image/gif"},
+	{[]byte("GIF89a"), "image/gif"},
+	{[]byte("\xff\xd8\xff"), "image/jpeg"},
+	{[]byte("BM"), "image/bmp"},
+	{[]byte("\x00\x00\x01\x00"), "image/x-icon"},
+	{[]byte("wOFF"), "font/woff"},
+	{[]byte("wOF2"), "font/woff2"},
+	{[]byte("\x00asm"), "application/wasm"},
+	{[]byte("PK\x03\x04"), "application/zip"},
+	{[]byte("\x1f\x8b\x08"), "application/x-gzip"},
+	{[]byte("OggS\x00"), "application/ogg"},
+	{[]byte("ID3"), "audio/mpeg"},
+}
+
+// htmlTags open an HTML document, compared case-insensitively.
+var htmlTags = []string{
+	"<!DOCTYPE HTML", "<HTML", "<HEAD", "<BODY", "<SCRIPT", "<STYLE",
+	"<TITLE", "<IFRAME", "<TABLE", "<DIV", "<P", "<A", "<H1", "<BR", "<!--",
+}
+
+// DetectContentType guesses the media type of data from at most its
+// first 512 bytes.
+//
+// It knows the magic numbers of common binary formats, recognizes
+// HTML and XML documents, and reports any other valid UTF-8 without
+// control bytes as plain text. Everything else is
+// "application/octet-stream".
+func DetectContentType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+
+	for _, sig := range signatures {
+		if bytes.HasPrefix(data, sig.prefix) {
+			return sig.contentType
+		}
+	}
+
+	// RIFF containers carry their type at offset 8
+	if len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) {
+		switch string(data[8:12]) {
+		case "WEBP":
+			return "image/webp"
+		case "WAVE":
+			return "audio/wave"
+		case "AVI ":
+			return "video/avi"
+		}
+	}
+
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		return "video/mp4"
+	}
+
+	text := bytes.TrimLeft(data, "\t\n\x0c\r ")
+
+	for _, tag := range htmlTags {
+		if hasTagPrefix(text, tag) {
+			return "text/html; charset=utf-8"
+		}
+	}
+
+	if bytes.HasPrefix(text, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+
+	return "application/octet-stream"
+}
+
+// hasTagPrefix reports whether data starts with tag followed by a
+// space or '>' (or, for comments, anything).
+func hasTagPrefix(data []byte, tag string) bool {
+	if len(data) < len(tag) || !bytes.EqualFold(data[:len(tag)], []byte(tag)) {
+		return false
+	}
+
+	if tag == "<!--" {
+		return true
+	}
+
+	if len(data) == len(tag) {
+		return false
+	}
+
+	c := data[len(tag)]
+
+	return c == ' ' || c == '>'
+}
+
+// isText reports whether data is UTF-8 without control bytes other
+// than whitespace. A rune cut off at the end of data is allowed.
+func isText(data []byte) bool {
+	for i := 0; i < len(data); {
+		c := data[i]
+
+		if c < utf8.RuneSelf {
+			if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\x0c' || c == 0x7f {
+				return false
+			}
+
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRune(data[i:])
+		}
+
+		i += size
+	}
+
+	return true
+}
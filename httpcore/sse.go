@@ -0,0 +1,197 @@
+package httpcore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHeartbeatInterval is how often an idle EventStream sends a
+// comment when EventStream.HeartbeatInterval is not set.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+var ErrStreamingUnsupported = errors.New("response writer does not support flushing")
+var ErrInvalidEvent = errors.New("event field contains a line break")
+
+// Event is one Server-Sent Event (text/event-stream).
+//
+// Only Data may span several lines; ID and Event must fit on one.
+type Event struct {
+	// ID becomes the client's last event ID, sent back in the
+	// Last-Event-ID header when it reconnects
+	ID string
+
+	// Event is the event type, "message" if empty
+	Event string
+
+	// Data is the payload. Each line is sent as its own "data:"
+	// field and joined back with "\n" by the client.
+	Data string
+
+	// Retry tells the client how long to wait before reconnecting,
+	// not sent if zero
+	Retry time.Duration
+}
+
+// EventStream writes Server-Sent Events to a response.
+//
+//	router.HandleRoute("GET /events", func(w ResponseWriter, r *Request) {
+//		stream, err := NewEventStream(w, r)
+//		if err != nil {
+//			w.WriteHeader(StatusInternalServerError)
+//			return
+//		}
+//
+//		stream.Stream(r.Context(), updatesSince(stream.LastEventID()))
+//	})
+//
+// The server doesn't watch the connection while the handler runs, a
+// client that disconnects is only noticed when a write to it fails,
+// which also cancels the request context.
+type EventStream struct {
+	w ResponseWriter
+
+	flusher Flusher
+
+	lastEventID string
+
+	// HeartbeatInterval is how often Stream sends a comment while
+	// no event is sent, so proxies keep the connection open and a
+	// gone client is noticed. DefaultHeartbeatInterval if zero.
+	//
+	// It bounds how long the request context outlives the client.
+	HeartbeatInterval time.Duration
+}
+
+// NewEventStream sets the event stream headers and sends them.
+//
+// It returns ErrStreamingUnsupported if w can't be flushed.
+func NewEventStream(w ResponseWriter, r *Request) (*EventStream, error) {
+	f, ok := w.(Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(StatusOK)
+
+	if err := f.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &EventStream{
+		w:           w,
+		flusher:     f,
+		lastEventID: r.Header.Get("Last-Event-ID"),
+	}, nil
+}
+
+// LastEventID returns the ID of the last event the client received
+// before reconnecting, or the empty string on a first connection.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send writes e and flushes it to the client.
+func (s *EventStream) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return ErrInvalidEvent
+	}
+
+	var sb strings.Builder
+
+	if len(e.ID) > 0 {
+		sb.WriteString("id: " + e.ID + "\n")
+	}
+
+	if len(e.Event) > 0 {
+		sb.WriteString("event: " + e.Event + "\n")
+	}
+
+	if e.Retry > 0 {
+		sb.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	for _, line := range splitLines(e.Data) {
+		sb.WriteString("data: " + line + "\n")
+	}
+
+	// A blank line dispatches the event
+	sb.WriteString("\n")
+
+	return s.write(sb.String())
+}
+
+// Comment writes a comment, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	var sb strings.Builder
+
+	for _, line := range splitLines(text) {
+		sb.WriteString(": " + line + "\n")
+	}
+
+	return s.write(sb.String())
+}
+
+// Stream sends every event received on events, and a heartbeat
+// comment whenever the stream was idle for HeartbeatInterval.
+//
+// It returns nil once events is closed, ctx.Err() once ctx is done
+// and the write error once the client is gone.
+//
+// A client that disconnects while the stream is idle is noticed by a
+// heartbeat: over TCP the first write after it left usually still
+// succeeds and the next one fails, so the request context stays live
+// for up to two heartbeat intervals after the client is gone.
+func (s *EventStream) Stream(ctx context.Context, events <-chan Event) error {
+	interval := s.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if err := s.Send(e); err != nil {
+				return err
+			}
+
+			heartbeat.Reset(interval)
+
+		case <-heartbeat.C:
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *EventStream) write(data string) error {
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return err
+	}
+
+	return s.flusher.Flush()
+}
+
+// splitLines splits s on "\r\n", "\r" and "\n", the line endings of
+// an event stream. It returns one empty line for an empty s.
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+
+	return strings.Split(s, "\n")
+}
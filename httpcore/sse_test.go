@@ -0,0 +1,158 @@
+package httpcore
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStreamSend(t *testing.T) {
+	req := &Request{Method: MethodGet, ProtocolMajor: 1, ProtocolMinor: 1, Header: make(Header)}
+	req.Header.Set("Last-Event-ID", "41")
+
+	res, out := newTestResponse(req)
+
+	stream, err := NewEventStream(res, req)
+	if err != nil {
+		t.Fatalf("NewEventStream: %s", err)
+	}
+
+	if stream.LastEventID() != "41" {
+		t.Fatalf("Expected last event ID 41, got %q", stream.LastEventID())
+	}
+
+	head := out.String()
+	if !strings.Contains(head, "Content-Type: text/event-stream; charset=utf-8\r\n") ||
+		!strings.Contains(head, "Cache-Control: no-cache\r\n") {
+		t.Fatalf("Expected event stream headers, got %q", head)
+	}
+
+	out.Reset()
+
+	err = stream.Send(Event{ID: "42", Event: "update", Data: "line one\r\nline two\rline three", Retry: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("Send: %s", err)
+	}
+
+	want := "id: 42\nevent: update\nretry: 3000\ndata: line one\ndata: line two\ndata: line three\n\n"
+	if got := out.String(); got != strconv.FormatInt(int64(len(want)), 16)+"\r\n"+want+"\r\n" {
+		t.Fatalf("Expected chunk %q, got %q", want, got)
+	}
+
+	if err := stream.Send(Event{Event: "bad\nevent"}); err != ErrInvalidEvent {
+		t.Fatalf("Expected ErrInvalidEvent, got %v", err)
+	}
+}
+
+func TestEventStreamStopsWhenClientLeaves(t *testing.T) {
+	done := make(chan error, 1)
+
+	router := NewRouter()
+	router.HandleRoute("GET /events", func(w ResponseWriter, r *Request) {
+		stream, err := NewEventStream(w, r)
+		if err != nil {
+			done <- err
+			return
+		}
+
+		stream.HeartbeatInterval = 10 * time.Millisecond
+
+		done <- stream.Stream(r.Context(), nil)
+	})
+
+	client := serveTestConn(t, &Server{Handler: router})
+
+	go io.WriteString(client, "GET /events HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	br := bufio.NewReader(client)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %s", err)
+		}
+
+		if strings.Contains(line, ": heartbeat") {
+			break
+		}
+	}
+
+	client.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Expected Stream to fail once the client is gone")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Stream did not notice the client leaving")
+	}
+}
+
+func TestEventStreamContextOutlivesClientUntilHeartbeat(t *testing.T) {
+	const interval = 100 * time.Millisecond
+
+	type result struct {
+		err       error
+		ctxErr    error
+		cancelled time.Time
+	}
+
+	done := make(chan result, 1)
+
+	router := NewRouter()
+	router.HandleRoute("GET /events", func(w ResponseWriter, r *Request) {
+		stream, err := NewEventStream(w, r)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		stream.HeartbeatInterval = interval
+
+		// Nothing is sent, only heartbeats can notice the client leave
+		err = stream.Stream(r.Context(), nil)
+
+		done <- result{err: err, ctxErr: r.Context().Err(), cancelled: time.Now()}
+	})
+
+	addr, _ := startTestServer(t, &Server{Handler: router})
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(client, "GET /events HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	br := bufio.NewReader(client)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %s", err)
+		}
+
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	client.Close()
+	left := time.Now()
+
+	select {
+	case res := <-done:
+		if res.err == nil || res.ctxErr == nil {
+			t.Fatalf("Expected a write error and a cancelled context, got %v and %v", res.err, res.ctxErr)
+		}
+
+		// Two heartbeats, plus some slack for a loaded machine
+		if after := res.cancelled.Sub(left); after > 2*interval+interval/2 {
+			t.Errorf("context cancelled %s after the client left, want at most two heartbeats", after)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stream did not notice the client leaving")
+	}
+}
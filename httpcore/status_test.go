@@ -0,0 +1,33 @@
+package httpcore
+
+import "testing"
+
+func TestStatusText(t *testing.T) {
+	for code, want := range map[int]string{
+		StatusCreated:                     "Created",
+		StatusNoContent:                   "No Content",
+		StatusTeapot:                      "I'm a teapot",
+		StatusRequestHeaderFieldsTooLarge: "Request Header Fields Too Large",
+		StatusGatewayTimeout:              "Gateway Timeout",
+		299:                               "",
+	} {
+		if got := StatusText(code); got != want {
+			t.Fatalf("StatusText(%d): expected %q, got %q", code, want, got)
+		}
+	}
+}
+
+func TestBodyAllowedForStatus(t *testing.T) {
+	for code, want := range map[int]bool{
+		StatusContinue:           false,
+		StatusSwitchingProtocols: false,
+		StatusOK:                 true,
+		StatusNoContent:          false,
+		StatusNotModified:        false,
+		StatusNotFound:           true,
+	} {
+		if got := BodyAllowedForStatus(code); got != want {
+			t.Fatalf("BodyAllowedForStatus(%d): expected %v, got %v", code, want, got)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package httpcore
+
+import (
+	"errors"
+	"strings"
+)
+
+// URL is a parsed request-target (RFC 7230, section 5.3).
+//
+// The request-target comes in four forms:
+//
+//	origin-form     /users/42?limit=10      (most requests)
+//	absolute-form   http://example.com/     (requests to proxies)
+//	authority-form  example.com:443         (CONNECT only)
+//	asterisk-form   *                       (server-wide OPTIONS only)
+type URL struct {
+	// Scheme is "http" or "https" for the absolute-form, empty otherwise
+	Scheme string
+
+	// Host is "host[:port]" for the absolute-form and authority-form,
+	// empty otherwise
+	Host string
+
+	// Path is the percent-decoded, normalized path ("/users/42").
+	//
+	// Empty segments, "." and ".." are resolved, so Path never climbs
+	// above "/". It is "*" for the asterisk-form and empty for the
+	// authority-form.
+	Path string
+
+	// RawPath is the path exactly as sent by the client (still encoded)
+	RawPath string
+
+	// RawQuery is the query without the leading '?' (still encoded)
+	RawQuery string
+}
+
+var ErrInvalidRequestTarget = errors.New("invalid request-target")
+var ErrPathTraversal = errors.New("request path escapes the root")
+
+// parseRequestTarget parses the request-target of a request line
+// sent with method.
+func parseRequestTarget(method, target string) (*URL, error) {
+	for i := 0; i < len(target); i++ {
+		// No whitespace, control or non-ASCII bytes and no fragment
+		if c := target[i]; c <= ' ' || c >= 0x7f || c == '#' {
+			return nil, ErrInvalidRequestTarget
+		}
+	}
+
+	switch {
+	case target == "*":
+		// asterisk-form
+		if method != MethodOptions {
+			return nil, ErrInvalidRequestTarget
+		}
+		return &URL{Path: "*", RawPath: "*"}, nil
+
+	case method == MethodConnect:
+		// authority-form = host ":" port
+		host, port, found := strings.Cut(target, ":")
+		if !found || len(host) == 0 || len(port) == 0 || strings.ContainsAny(target, "/?@") {
+			return nil, ErrInvalidRequestTarget
+		}
+		return &URL{Host: target}, nil
+
+	case strings.HasPrefix(target, "/"):
+		// origin-form = absolute-path [ "?" query ]
+		return parseOriginForm(target)
+
+	default:
+		// absolute-form = scheme "://" authority path-abempty [ "?" query ]
+		return parseAbsoluteForm(target)
+	}
+}
+
+func parseAbsoluteForm(target string) (*URL, error) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found {
+		return nil, ErrInvalidRequestTarget
+	}
+
+	scheme = strings.ToLower(scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil, ErrInvalidRequestTarget
+	}
+
+	host := rest
+	path := "/"
+
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		host = rest[:i]
+		path = rest[i:]
+
+		// "http://example.com?x=1" has an empty path
+		if path[0] == '?' {
+			path = "/" + path
+		}
+	}
+
+	// userinfo is deprecated in http URIs (RFC 7230, section 2.7.1)
+	if len(host) == 0 || strings.Contains(host, "@") {
+		return nil, ErrInvalidRequestTarget
+	}
+
+	u, err := parseOriginForm(path)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Scheme = scheme
+	u.Host = strings.ToLower(host)
+
+	return u, nil
+}
+
+func parseOriginForm(target string) (*URL, error) {
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err = cleanPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &URL{
+		Path:     path,
+		RawPath:  rawPath,
+		RawQuery: rawQuery,
+	}, nil
+}
+
+// cleanPath normalizes a decoded absolute path.
+//
+// Repeated slashes and "." segments are dropped and ".." removes the
+// previous segment. A ".." that would climb above "/" is rejected
+// with ErrPathTraversal. A trailing slash is kept.
+func cleanPath(path string) (string, error) {
+	segments := strings.Split(path[1:], "/")
+	out := make([]string, 0, len(segments))
+
+	for _, seg := range segments {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			if len(out) == 0 {
+				return "", ErrPathTraversal
+			}
+			out = out[:len(out)-1]
+		default:
+			out = append(out, seg)
+		}
+	}
+
+	cleaned := "/" + strings.Join(out, "/")
+
+	last := segments[len(segments)-1]
+	if len(out) > 0 && (last == "" || last == "." || last == "..") {
+		cleaned += "/"
+	}
+
+	return cleaned, nil
+}
+
+// unescape decodes percent-encoded octets ("%2F") in s.
+//
+// In query components '+' also stands for a space.
+func unescape(s string, query bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", ErrInvalidRequestTarget
+			}
+
+			sb.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+
+		case c == '+' && query:
+			sb.WriteByte(' ')
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// escapeSegment percent-encodes s for use as one path segment, so
+// '/', '?', '#', '%' and anything outside printable ASCII are escaped.
+func escapeSegment(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if isUnreserved(c) || strings.IndexByte("!$&'()*+,;=:@", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+
+		sb.WriteByte('%')
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0x0f])
+	}
+
+	return sb.String()
+}
+
+// isUnreserved reports whether c is an unreserved URI character
+// (RFC 3986, section 2.3).
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// Values maps a query parameter to its values.
+//
+// "?tag=a&tag=b&limit=10" gives
+//
+//	Values{"tag": {"a", "b"}, "limit": {"10"}}
+type Values map[string][]string
+
+// Get returns the first value for key, or the empty string.
+func (v Values) Get(key string) string {
+	if vs := v[key]; len(vs) > 0 {
+		return vs[0]
+	}
+
+	return ""
+}
+
+// Has reports whether key is present, even with an empty value.
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+
+	return ok
+}
+
+// Query parses RawQuery and returns the decoded values.
+//
+// Malformed pairs are skipped.
+func (u *URL) Query() Values {
+	v := make(Values)
+
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if len(pair) == 0 {
+			continue
+		}
+
+		key, value, _ := strings.Cut(pair, "=")
+
+		key, err := unescape(key, true)
+		if err != nil {
+			continue
+		}
+
+		value, err = unescape(value, true)
+		if err != nil {
+			continue
+		}
+
+		v[key] = append(v[key], value)
+	}
+
+	return v
+}
+
+// String reassembles the URL in request-target form
+func (u *URL) String() string {
+	var sb strings.Builder
+
+	if len(u.Scheme) > 0 {
+		sb.WriteString(u.Scheme + "://")
+	}
+
+	sb.WriteString(u.Host)
+	sb.WriteString(u.RawPath)
+
+	if len(u.RawQuery) > 0 {
+		sb.WriteString("?" + u.RawQuery)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,78 @@
+package httpcore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRequestTarget(t *testing.T) {
+	tests := []struct {
+		method, target string
+		want           URL
+	}{
+		{MethodGet, "/", URL{Path: "/", RawPath: "/"}},
+		{MethodGet, "/users/42?limit=10", URL{Path: "/users/42", RawPath: "/users/42", RawQuery: "limit=10"}},
+		{MethodGet, "/a//b/./c/../d/", URL{Path: "/a/b/d/", RawPath: "/a//b/./c/../d/"}},
+		{MethodGet, "/hello%20world", URL{Path: "/hello world", RawPath: "/hello%20world"}},
+		{MethodGet, "HTTP://Example.com:8080/x?y=1", URL{Scheme: "http", Host: "example.com:8080", Path: "/x", RawPath: "/x", RawQuery: "y=1"}},
+		{MethodGet, "http://example.com", URL{Scheme: "http", Host: "example.com", Path: "/", RawPath: "/"}},
+		{MethodConnect, "example.com:443", URL{Host: "example.com:443"}},
+		{MethodOptions, "*", URL{Path: "*", RawPath: "*"}},
+	}
+
+	for _, tt := range tests {
+		u, err := parseRequestTarget(tt.method, tt.target)
+		if err != nil {
+			t.Fatalf("%s %s: %s", tt.method, tt.target, err)
+		}
+
+		if *u != tt.want {
+			t.Fatalf("%s %s: expected %+v, got %+v", tt.method, tt.target, tt.want, *u)
+		}
+	}
+}
+
+func TestParseRequestTargetErrors(t *testing.T) {
+	tests := []struct {
+		method, target string
+		err            error
+	}{
+		{MethodGet, "/../etc/passwd", ErrPathTraversal},
+		{MethodGet, "/static/%2e%2e/%2e%2e/secret", ErrPathTraversal},
+		{MethodGet, "/bad%zzescape", ErrInvalidRequestTarget},
+		{MethodGet, "/frag#ment", ErrInvalidRequestTarget},
+		{MethodGet, "*", ErrInvalidRequestTarget},
+		{MethodGet, "ftp://example.com/", ErrInvalidRequestTarget},
+		{MethodGet, "http://user@example.com/", ErrInvalidRequestTarget},
+		{MethodConnect, "example.com", ErrInvalidRequestTarget},
+		{MethodGet, "users", ErrInvalidRequestTarget},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseRequestTarget(tt.method, tt.target); !errors.Is(err, tt.err) {
+			t.Fatalf("%s %s: expected %v, got %v", tt.method, tt.target, tt.err, err)
+		}
+	}
+}
+
+func TestURLQuery(t *testing.T) {
+	u := &URL{RawQuery: "limit=10&tag=a&tag=b%2Bc&q=hello+world&flag"}
+
+	q := u.Query()
+
+	if q.Get("limit") != "10" {
+		t.Fatalf("Expected limit 10, got %q", q.Get("limit"))
+	}
+
+	if tags := q["tag"]; len(tags) != 2 || tags[0] != "a" || tags[1] != "b+c" {
+		t.Fatalf("Expected tags [a b+c], got %q", tags)
+	}
+
+	if q.Get("q") != "hello world" {
+		t.Fatalf("Expected q %q, got %q", "hello world", q.Get("q"))
+	}
+
+	if !q.Has("flag") || q.Get("flag") != "" {
+		t.Fatalf("Expected empty flag value")
+	}
+}
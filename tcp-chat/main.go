@@ -2,15 +2,58 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// ErrServerClosed is returned by Start after Shutdown or Close.
+var ErrServerClosed = errors.New("Server closed")
+
+// shutdownTimeout is how long run waits for clients on Ctrl+C.
+const shutdownTimeout = 10 * time.Second
+
+// DefaultIdleTimeout is how long a client may stay silent when
+// ChatServer.IdleTimeout is not set.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// DefaultWriteTimeout is how long a broadcast may wait on one client
+// when ChatServer.WriteTimeout is not set.
+const DefaultWriteTimeout = 10 * time.Second
+
+// shutdownNoticeTimeout bounds how long Shutdown tries to deliver its
+// notice, a client that stopped reading must not hold it up.
+const shutdownNoticeTimeout = time.Second
+
 type ChatServer struct {
-	clients []net.Conn
-	ln      net.Listener
+	// IdleTimeout is how long a client may go without sending a
+	// line before it is disconnected. Slow senders trickling a line
+	// byte by byte are disconnected too.
+	//
+	// If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// WriteTimeout is how long a message may take to reach a client.
+	// A client that does not read it in time is disconnected, so it
+	// can't hold up the chat for everyone else.
+	//
+	// If zero, DefaultWriteTimeout is used.
+	WriteTimeout time.Duration
+
+	mu             sync.Mutex // guards clients, closing and noticeDeadline, never held while writing
+	clients        map[net.Conn]*client
+	closing        bool
+	noticeDeadline time.Time // for the shutdown notice
+
+	ln net.Listener
+	wg sync.WaitGroup // one per connection goroutine
 }
 
 // Creates a new Chat server
@@ -23,11 +66,13 @@ func NewChatServer(port string) (*ChatServer, error) {
 	}
 
 	return &ChatServer{
-		clients: make([]net.Conn, 0),
+		clients: make(map[net.Conn]*client),
 		ln:      ln,
 	}, nil
 }
 
+// Start accepts connections until Shutdown or Close is called, then
+// returns ErrServerClosed.
 func (c *ChatServer) Start() error {
 	fmt.Printf("[SERVER] started accepting connections on: %s\n", c.ln.Addr())
 
@@ -35,31 +80,159 @@ func (c *ChatServer) Start() error {
 		conn, err := c.ln.Accept()
 
 		if err != nil {
-			fmt.Printf("[ERROR] could not accept client connection from %s\n", conn.RemoteAddr())
+			if c.isClosing() {
+				return ErrServerClosed
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			fmt.Printf("[ERROR] could not accept client connection, err: %s\n", err)
+			time.Sleep(10 * time.Millisecond)
 			continue
 		}
 
 		fmt.Printf("[SERVER] new client connected: %s\n", conn.RemoteAddr())
 
-		// Push this client to clients slice
-		c.clients = append(c.clients, conn)
+		// Push this client to clients
+		cl := c.addClient(conn)
+		if cl == nil {
+			conn.Close()
+			return ErrServerClosed
+		}
 
 		// Handle the connection
-		go c.handleConnection(conn)
+		go c.handleConnection(cl)
+	}
+}
+
+// Shutdown stops accepting connections, tells every client the
+// server is going away and disconnects them once the message being
+// broadcast (if any) was delivered. Writes to clients that don't read
+// are cut short after shutdownNoticeTimeout. It returns when all
+// connection goroutines exited, or with the context's error if ctx
+// expires first.
+func (c *ChatServer) Shutdown(ctx context.Context) error {
+	deadline := time.Now().Add(shutdownNoticeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
 	}
+
+	c.mu.Lock()
+	c.closing = true
+	c.noticeDeadline = deadline
+	err := c.ln.Close()
+
+	for conn := range c.clients {
+		// Ends a broadcast stuck on this client
+		conn.SetWriteDeadline(deadline)
+
+		// Unblocks the reader, which then sends the notice and
+		// closes the connection
+		conn.SetReadDeadline(time.Now())
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting connections and drops every client at once.
+func (c *ChatServer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closing = true
+	err := c.ln.Close()
+
+	for conn := range c.clients {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (c *ChatServer) isClosing() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closing
+}
+
+// shutdownNotice reports whether the server is shutting down, and
+// until when its notice may take to reach a client.
+func (c *ChatServer) shutdownNotice() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.noticeDeadline, c.closing
+}
+
+// addClient returns nil if the server is shutting down, otherwise
+// the connection goroutine is counted before Shutdown can wait for it.
+func (c *ChatServer) addClient(conn net.Conn) *client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing {
+		return nil
+	}
+
+	cl := &client{conn: conn}
+	c.clients[conn] = cl
+	c.wg.Add(1)
+
+	return cl
+}
+
+func (c *ChatServer) removeClient(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.clients, conn)
 }
 
 // Handle connection life cycle
-func (c *ChatServer) handleConnection(conn net.Conn) {
+func (c *ChatServer) handleConnection(cl *client) {
+	conn := cl.conn
+
+	defer c.wg.Done()
 	defer conn.Close()
+	defer c.removeClient(conn)
 
 	reader := bufio.NewReader(conn)
 	// Read from connection
 	for {
+		conn.SetReadDeadline(time.Now().Add(c.idleTimeout()))
+
+		// Shutdown may have set its deadline before ours
+		if deadline, closing := c.shutdownNotice(); closing {
+			c.disconnect(cl, deadline)
+			return
+		}
+
 		bytes, err := reader.ReadBytes(byte('\n'))
 
 		if err != nil {
-			if err != io.EOF {
+			var ne net.Error
+
+			if deadline, closing := c.shutdownNotice(); closing {
+				c.disconnect(cl, deadline)
+			} else if errors.As(err, &ne) && ne.Timeout() {
+				fmt.Printf("[SERVER] evicting idle client %s\n", conn.RemoteAddr())
+				cl.write([]byte("[SERVER] disconnected: idle for too long\n"), time.Now().Add(c.writeTimeout()))
+			} else if err != io.EOF {
 				fmt.Printf("[ERROR] reading from connection %s, err: %s\n", conn.RemoteAddr(), err)
 			} else {
 				fmt.Printf("[ERROR] client connection closed %s\n", conn.RemoteAddr())
@@ -70,27 +243,82 @@ func (c *ChatServer) handleConnection(conn net.Conn) {
 
 		// Broadcast the message to all
 		msg := fmt.Sprintf("[CLIENT] %s", bytes)
-		c.broadcastExceptSelf(conn, []byte(msg))
+		c.broadcastExceptSelf(cl, []byte(msg))
+	}
+}
+
+func (c *ChatServer) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return c.IdleTimeout
+	}
+
+	return DefaultIdleTimeout
+}
+
+func (c *ChatServer) writeTimeout() time.Duration {
+	if c.WriteTimeout > 0 {
+		return c.WriteTimeout
 	}
+
+	return DefaultWriteTimeout
 }
 
-func (c *ChatServer) broadcastExceptSelf(conn net.Conn, msg []byte) {
-	// iterate over clients slice
-	for _, client := range c.clients {
+// disconnect tells cl the server is shutting down.
+func (c *ChatServer) disconnect(cl *client, deadline time.Time) {
+	fmt.Printf("[SERVER] disconnecting client %s\n", cl.conn.RemoteAddr())
+	cl.write([]byte("[SERVER] shutting down\n"), deadline)
+}
+
+// broadcastExceptSelf sends msg to every client but the sender. The
+// clients are written to without holding the lock, a client that
+// doesn't take msg before the write timeout is dropped.
+func (c *ChatServer) broadcastExceptSelf(sender *client, msg []byte) {
+	deadline := time.Now().Add(c.writeTimeout())
+
+	c.mu.Lock()
+	clients := make([]*client, 0, len(c.clients))
+	for _, cl := range c.clients {
 		// Skip the sender
-		if client == conn {
-			continue
+		if cl != sender {
+			clients = append(clients, cl)
 		}
+	}
 
-		_, err := client.Write(msg)
+	if c.closing && c.noticeDeadline.Before(deadline) {
+		deadline = c.noticeDeadline
+	}
+	c.mu.Unlock()
 
-		if err != nil {
-			fmt.Printf("[ERROR] writing to client, %s\n", err)
-			continue
+	for _, cl := range clients {
+		if err := cl.write(msg, deadline); err != nil {
+			fmt.Printf("[ERROR] writing to client %s, dropping it, err: %s\n", cl.conn.RemoteAddr(), err)
+
+			// Unblocks its reader, which then removes it
+			cl.conn.Close()
 		}
 	}
 }
 
+// client is a connected peer. Its mutex keeps messages written to it
+// from different goroutines whole.
+type client struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+// write sends msg, giving up at deadline.
+func (cl *client) write(msg []byte, deadline time.Time) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.conn.SetWriteDeadline(deadline)
+	_, err := cl.conn.Write(msg)
+
+	return err
+}
+
+// run serves until the process is interrupted, then shuts the server
+// down gracefully.
 func run(args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("Expected 2 arguments got %d\n", len(args))
@@ -101,11 +329,30 @@ func run(args []string) error {
 	server, err := NewChatServer(port)
 
 	if err != nil {
-		os.Exit(1)
+		return err
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start accepting connections
-	return server.Start()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Start()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("[SERVER] shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(ctx)
 }
 
 func main() {
@@ -113,6 +360,4 @@ func main() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-
-	run(os.Args)
 }
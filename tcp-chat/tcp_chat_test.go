@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"net"
 	"testing"
@@ -50,3 +51,212 @@ func TestChatServer(t *testing.T) {
 		t.Fatalf("Expected %s, got %s", expect, msgR)
 	}
 }
+
+func TestChatServerShutdown(t *testing.T) {
+	server, err := NewChatServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start()
+	}()
+
+	var clients []net.Conn
+	for range 2 {
+		c, err := net.Dial("tcp", server.ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		clients = append(clients, c)
+	}
+
+	// Wait until both clients are registered
+	for deadline := time.Now().Add(time.Second); ; {
+		server.mu.Lock()
+		n := len(server.clients)
+		server.mu.Unlock()
+
+		if n == 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients connected, want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+
+	if err := <-started; err != ErrServerClosed {
+		t.Errorf("Start returned %v, want ErrServerClosed", err)
+	}
+
+	for _, c := range clients {
+		reader := bufio.NewReader(c)
+
+		msg, err := reader.ReadString('\n')
+		if err != nil || msg != "[SERVER] shutting down\n" {
+			t.Errorf("got %q %v, want the shutdown notice", msg, err)
+		}
+
+		if _, err := reader.ReadByte(); err != io.EOF {
+			t.Errorf("connection still open after Shutdown, err %v", err)
+		}
+	}
+}
+
+func TestChatServerEvictsIdleClients(t *testing.T) {
+	server, err := NewChatServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.IdleTimeout = 50 * time.Millisecond
+
+	go server.Start()
+	defer server.Close()
+
+	c, err := net.Dial("tcp", server.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reader := bufio.NewReader(c)
+
+	msg, err := reader.ReadString('\n')
+	if err != nil || msg != "[SERVER] disconnected: idle for too long\n" {
+		t.Fatalf("got %q %v, want the idle notice", msg, err)
+	}
+
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open after eviction, err %v", err)
+	}
+}
+
+func TestChatServerShutdownWithStuckClient(t *testing.T) {
+	server, err := NewChatServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes to a pipe block until the other end reads, which it never does
+	conn, stuck := net.Pipe()
+	defer stuck.Close()
+
+	go server.handleConnection(server.addClient(conn))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*shutdownNoticeTimeout {
+		t.Errorf("Shutdown took %s with a client that does not read", elapsed)
+	}
+}
+
+func TestChatServerShutdownDuringStuckBroadcast(t *testing.T) {
+	server, err := NewChatServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	senderConn, sender := net.Pipe()
+	defer sender.Close()
+
+	// Never reads, so the broadcast blocks on it
+	stuckConn, stuck := net.Pipe()
+	defer stuck.Close()
+
+	go server.handleConnection(server.addClient(senderConn))
+	go server.handleConnection(server.addClient(stuckConn))
+
+	go io.Copy(io.Discard, sender)
+
+	// Returns once the server read the line, the broadcast follows
+	if _, err := sender.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Clients can still come and go while the broadcast is stuck
+	added := make(chan struct{})
+	go func() {
+		conn, other := net.Pipe()
+		defer other.Close()
+
+		server.addClient(conn)
+		server.removeClient(conn)
+		server.wg.Done()
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("adding a client blocked behind a stuck broadcast")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*shutdownNoticeTimeout {
+		t.Errorf("Shutdown took %s with a broadcast stuck on a client", elapsed)
+	}
+}
+
+func TestChatServerDropsClientsThatDontRead(t *testing.T) {
+	server, err := NewChatServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.WriteTimeout = 50 * time.Millisecond
+	defer server.Close()
+
+	senderConn, sender := net.Pipe()
+	defer sender.Close()
+
+	stuckConn, stuck := net.Pipe()
+	defer stuck.Close()
+
+	go server.handleConnection(server.addClient(senderConn))
+	go server.handleConnection(server.addClient(stuckConn))
+
+	sender.Write([]byte("hello\n"))
+
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		server.mu.Lock()
+		_, ok := server.clients[stuckConn]
+		server.mu.Unlock()
+
+		if !ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("client that does not read still connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
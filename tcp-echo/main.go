@@ -2,45 +2,199 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
-func main() {
-	ln, err := net.Listen("tcp", ":8080")
+// ErrServerClosed is returned by Serve after Shutdown or Close.
+var ErrServerClosed = errors.New("Server closed")
+
+// shutdownTimeout is how long main waits for clients on Ctrl+C.
+const shutdownTimeout = 10 * time.Second
+
+// DefaultIdleTimeout is how long a client may stay silent when
+// EchoServer.IdleTimeout is not set.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// EchoServer sends every line a client writes back to it.
+type EchoServer struct {
+	// IdleTimeout is how long a client may take to send its next
+	// line before it is disconnected.
+	//
+	// If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	ln net.Listener
+
+	mu      sync.Mutex // guards conns and closing
+	conns   map[net.Conn]struct{}
+	closing bool
+
+	wg sync.WaitGroup // one per connection goroutine
+}
+
+func NewEchoServer(addr string) (*EchoServer, error) {
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		fmt.Println("[SERVER] error starting TCP server, err:", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	fmt.Printf("[SERVER] listening on %s\n", ln.Addr())
+	return &EchoServer{
+		ln:    ln,
+		conns: make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections until Shutdown or Close is called, then
+// returns ErrServerClosed.
+func (s *EchoServer) Serve() error {
+	fmt.Printf("[SERVER] listening on %s\n", s.ln.Addr())
 
 	// Continuously listen for new connections
 	for {
-		conn, err := ln.Accept()
+		conn, err := s.ln.Accept()
 		if err != nil {
+			if s.isClosing() {
+				return ErrServerClosed
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
 			fmt.Println("error connecting to client, err:", err)
+			time.Sleep(10 * time.Millisecond)
 			continue
 		}
 
 		fmt.Printf("[SERVER] client connected %s\n", conn.LocalAddr())
 
+		if !s.track(conn, true) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
 		// handle the connection
-		go handleConnection(conn)
+		go s.handleConnection(conn)
+	}
+}
+
+// Shutdown stops accepting connections and closes every connection
+// once the line it is echoing (if any) was sent back. It returns when
+// all connection goroutines exited, or with the context's error if
+// ctx expires first.
+func (s *EchoServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	err := s.ln.Close()
+
+	// Unblocks idle readers; a connection echoing a line notices
+	// closing after writing it
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting connections and closes every connection at
+// once.
+func (s *EchoServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closing = true
+	err := s.ln.Close()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (s *EchoServer) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+
+	return DefaultIdleTimeout
+}
+
+func (s *EchoServer) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closing
+}
+
+// track adds or removes conn. It reports false if a connection is
+// added while shutting down, otherwise the connection goroutine is
+// counted before Shutdown can wait for it.
+func (s *EchoServer) track(conn net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, conn)
+		return true
+	}
+
+	if s.closing {
+		return false
 	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return true
 }
 
-func handleConnection(conn net.Conn) {
+func (s *EchoServer) handleConnection(conn net.Conn) {
+	defer s.wg.Done()
 	defer conn.Close()
+	defer s.track(conn, false)
 
 	reader := bufio.NewReader(conn)
 
 	for {
+		conn.SetReadDeadline(time.Now().Add(s.idleTimeout()))
+
+		// Shutdown may have set its deadline before ours
+		if s.isClosing() {
+			return
+		}
+
 		bytes, err := reader.ReadBytes(byte('\n'))
 		if err != nil {
-			if err != io.EOF {
+			var ne net.Error
+
+			switch {
+			case s.isClosing():
+			case errors.As(err, &ne) && ne.Timeout():
+				fmt.Printf("[SERVER] evicting idle client: %s\n", conn.RemoteAddr())
+				return
+			case err != io.EOF:
 				fmt.Println("failed to read data, err:", err)
 			}
 			fmt.Printf("[SERVER] client closed connection: %s\n", conn.LocalAddr())
@@ -51,5 +205,42 @@ func handleConnection(conn net.Conn) {
 
 		// send the message back to the client
 		conn.Write(bytes)
+
+		if s.isClosing() {
+			return
+		}
+	}
+}
+
+func main() {
+	server, err := NewEchoServer(":8080")
+	if err != nil {
+		fmt.Println("[SERVER] error starting TCP server, err:", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve()
+	}()
+
+	select {
+	case err := <-errc:
+		fmt.Println(err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	fmt.Println("[SERVER] shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 }
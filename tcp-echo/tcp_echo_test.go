@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEchoServerShutdown(t *testing.T) {
+	server, err := NewEchoServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	var clients []net.Conn
+	for range 2 {
+		c, err := net.Dial("tcp", server.ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		clients = append(clients, c)
+	}
+
+	// An echo round trip means the client is tracked
+	for _, c := range clients {
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		c.Write([]byte("ping\n"))
+
+		reader := bufio.NewReader(c)
+
+		for _, want := range []string{"ping\n", "sent by server\n"} {
+			if line, err := reader.ReadString('\n'); err != nil || line != want {
+				t.Fatalf("got %q %v, want %q", line, err, want)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+
+	for _, c := range clients {
+		if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("connection still open after Shutdown, err %v", err)
+		}
+	}
+
+	if _, err := net.Dial("tcp", server.ln.Addr().String()); err == nil {
+		t.Errorf("still accepting connections after Shutdown")
+	}
+}
+
+func TestEchoServerEvictsIdleClients(t *testing.T) {
+	server, err := NewEchoServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.IdleTimeout = 50 * time.Millisecond
+
+	go server.Serve()
+	defer server.Close()
+
+	c, err := net.Dial("tcp", server.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("connection still open after the idle timeout, err %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Package tlsutil generates self-signed certificates for local
+// development and tests.
+//
+//	cert, err := tlsutil.SelfSignedCertificate("localhost", "127.0.0.1")
+//	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// DefaultValidity is how long generated certificates are valid for.
+const DefaultValidity = 365 * 24 * time.Hour
+
+// DefaultHosts are used when no hosts are passed to the generators.
+var DefaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// SelfSigned returns a PEM encoded certificate and private key valid
+// for hosts, which may be DNS names or IP addresses.
+func SelfSigned(hosts ...string) (certPEM, keyPEM []byte, err error) {
+	if len(hosts) == 0 {
+		hosts = DefaultHosts
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notBefore := time.Now().Add(-time.Minute)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(DefaultValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		// Self-signed, so the certificate is its own CA. Clients can
+		// trust it by adding it to their root pool.
+		IsCA: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// SelfSignedCertificate is like SelfSigned but returns a certificate
+// ready to be used in a tls.Config.
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	certPEM, keyPEM, err := SelfSigned(hosts...)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// WriteSelfSigned generates a certificate for hosts and writes it to
+// certFile and its private key to keyFile.
+func WriteSelfSigned(certFile, keyFile string, hosts ...string) error {
+	certPEM, keyPEM, err := SelfSigned(hosts...)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+
+	// The key must not be readable by other users
+	return os.WriteFile(keyFile, keyPEM, 0600)
+}
@@ -2,10 +2,21 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"io"
 	"net"
+	"os"
+)
+
+var (
+	addr     = flag.String("addr", "localhost:8443", "server address")
+	plain    = flag.Bool("plain", false, "connect with ws:// instead of wss://")
+	caFile   = flag.String("ca", "", "certificate to trust, e.g. certs/server.crt")
+	insecure = flag.Bool("insecure", false, "skip certificate verification, e.g. for the certificate the example server generates when started without -cert")
 )
 
 // =====================
@@ -13,6 +24,8 @@ import (
 // =====================
 
 func main() {
+	flag.Parse()
+
 	testTextThenClose()
 }
 
@@ -21,17 +34,18 @@ func main() {
 // =====================
 
 func dialAndHandshake() (*bufio.Reader, *bufio.Writer, net.Conn) {
-	conn, err := net.Dial("tcp", "localhost:8080")
+	conn, err := dial()
 	if err != nil {
-		panic(err)
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 	r := bufio.NewReader(conn)
 	w := bufio.NewWriter(conn)
 
 	req := "" +
-		"GET / HTTP/1.1\r\n" +
-		"Host: localhost:8080\r\n" +
+		"GET /ws/echo HTTP/1.1\r\n" +
+		"Host: " + *addr + "\r\n" +
 		"Upgrade: websocket\r\n" +
 		"Connection: Upgrade\r\n" +
 		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
@@ -51,6 +65,31 @@ func dialAndHandshake() (*bufio.Reader, *bufio.Writer, net.Conn) {
 	return r, w, conn
 }
 
+func dial() (net.Conn, error) {
+	if *plain {
+		return net.Dial("tcp", *addr)
+	}
+
+	config := &tls.Config{InsecureSkipVerify: *insecure}
+
+	if len(*caFile) > 0 {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", *caFile)
+		}
+
+		config.RootCAs = roots
+		config.InsecureSkipVerify = false
+	}
+
+	return tls.Dial("tcp", *addr, config)
+}
+
 // =====================
 // Frame reader (server → client)
 // =====================
@@ -78,6 +117,10 @@ func readFrame(r *bufio.Reader) (opcode byte, payload []byte, err error) {
 		ext := make([]byte, 2)
 		io.ReadFull(r, ext)
 		payloadLen = int(binary.BigEndian.Uint16(ext))
+	} else if payloadLen == 127 {
+		ext := make([]byte, 8)
+		io.ReadFull(r, ext)
+		payloadLen = int(binary.BigEndian.Uint64(ext))
 	}
 
 	payload = make([]byte, payloadLen)
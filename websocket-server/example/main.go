@@ -1,25 +1,111 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/suman7383/networking-from-scratch/httpcore"
+	"github.com/suman7383/networking-from-scratch/tlsutil"
 	"github.com/suman7383/networking-from-scratch/websocket-server/internal/server"
 	"github.com/suman7383/networking-from-scratch/websocket-server/internal/websocket"
 )
 
+// shutdownTimeout is how long connections get to close on Ctrl+C
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	addr := flag.String("addr", ":8443", "address to listen on")
+	plain := flag.Bool("plain", false, "serve ws:// instead of wss://")
+	certFile := flag.String("cert", "", "certificate file (a self-signed one is generated if empty)")
+	keyFile := flag.String("key", "", "private key file")
+	flag.Parse()
+
+	s := server.NewServer(*addr)
+
+	// Browsers offer permessage-deflate, repetitive messages get much smaller
+	s.Upgrader.EnableCompression = true
 
-	s := server.NewServer(":8443", func(w websocket.DataWriter, data []byte) {
+	// Plain HTTP routes share the listener with the WebSocket endpoints
+	s.HandleFunc("GET /health", func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	s.HandleWebSocket("/ws/echo", func(w websocket.DataWriter, data []byte) {
 		fmt.Println("Received data", string(data))
 
 		w.Send([]byte("Got it!"), websocket.DataTypeText)
 	})
 
-	err := s.ListenAndServe()
+	s.HandleWebSocket("/ws/shout", func(w websocket.DataWriter, data []byte) {
+		w.Send([]byte(strings.ToUpper(string(data))), websocket.DataTypeText)
+	})
+
+	// Messages are echoed back as they arrive, without holding them in memory
+	s.HandleWebSocketStream("/ws/stream", func(c *websocket.WebSocketConn) {
+		for {
+			dt, r, err := c.NextReader()
+			if err != nil {
+				return
+			}
+
+			w, err := c.NextWriter(dt)
+			if err != nil {
+				return
+			}
+
+			io.Copy(w, r)
+			w.Close()
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listenAndServe(s, *plain, *certFile, *keyFile)
+	}()
 
-	if err != nil {
+	select {
+	case err := <-errc:
 		fmt.Println(err.Error())
 		os.Exit(1)
+	case <-ctx.Done():
 	}
+
+	fmt.Println("shutting down")
+
+	// Clients get a Going Away close frame and a few seconds to answer
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		fmt.Println(err.Error())
+		s.Close()
+	}
+}
+
+func listenAndServe(s *server.Server, plain bool, certFile, keyFile string) error {
+	if plain {
+		return s.ListenAndServe()
+	}
+
+	if len(certFile) == 0 {
+		cert, err := tlsutil.SelfSignedCertificate()
+		if err != nil {
+			return err
+		}
+
+		s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	return s.ListenAndServeTLS(certFile, keyFile)
 }
@@ -1,123 +1,218 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
-	"errors"
-	"log"
-	"log/slog"
 	"net"
-	"os"
+	"sync"
+	"time"
 
-	"github.com/suman7383/networking-from-scratch/websocket-server/internal/httpcore"
+	"github.com/suman7383/networking-from-scratch/httpcore"
 	"github.com/suman7383/networking-from-scratch/websocket-server/internal/websocket"
-	"github.com/suman7383/networking-from-scratch/websocket-server/utils"
 )
 
+// shutdownPollInterval is how often Shutdown checks whether the
+// WebSocket connections are gone.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Server serves WebSocket endpoints and plain HTTP routes on the
+// same listener.
+//
+//	s := server.NewServer(":8443")
+//	s.HandleFunc("GET /health", health)
+//	s.HandleWebSocket("/ws/chat", chat)
+//	s.HandleWebSocket("/ws/echo", echo)
+//	s.HandleWebSocketStream("/ws/upload", upload)
 type Server struct {
 	// Addr Specifies the TCP address for the server to listen on,
 	// in form "host:port".
-	Addr    string
-	Handler websocket.HandlerFunc
+	Addr string
+
+	// Upgrader upgrades the requests of every WebSocket endpoint,
+	// set its CheckOrigin to accept cross-origin browsers.
+	Upgrader websocket.Upgrader
+
+	// TLSConfig configures ListenAndServeTLS, see httpcore.Server.
+	TLSConfig *tls.Config
+
+	router *httpcore.Router
+
+	http *httpcore.Server
+
+	mu        sync.Mutex
+	conns     map[*websocket.WebSocketConn]struct{}
+	upgrading int  // handshakes in progress, their connections are not tracked yet
+	closing   bool // Shutdown started, new connections are closed right away
 }
 
-func NewServer(addr string, handler websocket.HandlerFunc) *Server {
-	return &Server{
-		Addr:    addr,
-		Handler: handler,
+func NewServer(addr string) *Server {
+	s := &Server{
+		Addr:   addr,
+		router: httpcore.NewRouter(),
+		conns:  make(map[*websocket.WebSocketConn]struct{}),
 	}
-}
 
-func (s *Server) ListenAndServe() error {
+	s.http = &httpcore.Server{Handler: s.router}
+	s.http.RegisterOnShutdown(s.goAway)
 
-	cwd, _ := os.Getwd()
-	log.Println("Working directory:", cwd)
+	return s
+}
 
-	// load the cert
-	cert, err := tls.LoadX509KeyPair("certs/server.crt", "certs/server.key")
-	if err != nil {
-		log.Fatal(err)
-	}
+// Handle registers an HTTP handler for pattern ("[METHOD ]/path").
+func (s *Server) Handle(pattern string, handler httpcore.Handler) {
+	s.router.Handle(pattern, handler)
+}
 
-	// Create the Tls config
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}
+// HandleFunc registers an HTTP handler function for pattern.
+func (s *Server) HandleFunc(pattern string, handler httpcore.HandlerFunc) {
+	s.router.Handle(pattern, handler)
+}
 
-	ln, err := tls.Listen("tcp", s.Addr, tlsConfig)
-	if err != nil {
-		return err
-	}
+// HandleWebSocket registers a WebSocket endpoint at path. Every
+// message received on its connections is passed to handler.
+func (s *Server) HandleWebSocket(path string, handler websocket.HandlerFunc) {
+	s.handleUpgrade(path, handler, (*websocket.WebSocketConn).Handle)
+}
 
-	slog.Info("[SERVER] started listening\n")
+// HandleWebSocketStream registers a WebSocket endpoint at path whose
+// handler reads and writes messages as streams, see
+// websocket.WebSocketConn.NextReader and NextWriter.
+func (s *Server) HandleWebSocketStream(path string, handler websocket.StreamHandlerFunc) {
+	s.handleUpgrade(path, nil, func(wsc *websocket.WebSocketConn) {
+		wsc.HandleStream(handler)
+	})
+}
 
-	// Listen for new connection
-	for {
-		conn, err := ln.Accept()
+// handleUpgrade registers the route upgrading requests at path, each
+// connection is tracked while serve runs.
+//
+// The hijacked connection is no longer one of the HTTP server's, so
+// the handshake is counted until the connection is tracked, Shutdown
+// waits for both.
+func (s *Server) handleUpgrade(path string, handler websocket.HandlerFunc, serve func(*websocket.WebSocketConn)) {
+	s.router.HandleRoute(httpcore.MethodGet+" "+path, func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		s.countUpgrade(1)
+
+		wsc, err := s.Upgrader.Upgrade(w, r, handler)
 		if err != nil {
-			return err
+			s.countUpgrade(-1)
+			return
 		}
 
-		slog.Info("[SERVER] client connected: ", slog.String("Addr", conn.RemoteAddr().String()))
+		s.trackConn(wsc, true)
+		defer s.trackConn(wsc, false)
 
-		go s.serve(conn)
-	}
+		// Pass the control to WebSocket handler
+		serve(wsc)
+	})
 }
 
-func (s *Server) serve(conn net.Conn) {
-	defer conn.Close()
+// ListenAndServe serves plain HTTP (ws://) on s.Addr.
+func (s *Server) ListenAndServe() error {
+	return s.httpServer().ListenAndServe()
+}
 
-	// TODO: Read and parse the incomming request
-	reader := httpcore.NewReader(conn)
+// ListenAndServeTLS serves HTTPS (wss://) on s.Addr with the
+// certificate in certFile and keyFile. They may be empty if
+// s.TLSConfig already has a certificate.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	return s.httpServer().ListenAndServeTLS(certFile, keyFile)
+}
 
-	req, err := httpcore.ReadRequest(reader)
+// Serve serves plain HTTP (ws://) on the connections accepted by ln.
+func (s *Server) Serve(ln net.Listener) error {
+	return s.httpServer().Serve(ln)
+}
 
+// Shutdown stops accepting connections, lets the HTTP requests being
+// served finish and closes every WebSocket connection with
+// CloseGoingAway. It returns once all of them are gone, or with the
+// context's error if ctx expires first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
 	if err != nil {
-		// Send error response
-		utils.WriteErrResponse(conn, httpcore.StatusBadRequest, err.Error())
-		return
+		return err
 	}
 
-	// Verify if it is an upgrade(websocket) request
-	// If not, respond with a error
-	err = s.handleUpgradeControl(req)
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
 
-	if err != nil {
-		// Send error (no upgrade header found)
-		utils.WriteErrResponse(conn, httpcore.StatusBadRequest, err.Error())
-		return
+	for {
+		if s.connCount() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
+}
 
-	// Handshake
-	wsc, err := websocket.HandleHandshake(req, conn, s.Handler)
+// Close closes the listener and every connection right away, without
+// closing handshakes.
+func (s *Server) Close() error {
+	err := s.http.Close()
 
-	if err != nil {
-		// TODO: Handshake failure. Failure response is already sent
-		//
-		// maybe log the error here and return ?
-		slog.Error(err.Error())
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		return
+	for wsc := range s.conns {
+		wsc.Terminate()
 	}
 
-	// Pass the control to WebSocket handler
-	wsc.Handle()
+	return err
+}
+
+func (s *Server) httpServer() *httpcore.Server {
+	s.http.Addr = s.Addr
+	s.http.TLSConfig = s.TLSConfig
+
+	return s.http
 }
 
-var ErrMissingConnectionUpgrade = errors.New("Missing Connection upgrade header")
-var ErrUnsupportedUpgrade = errors.New("Provided upgrade not support")
+// goAway starts the closing handshake on every WebSocket connection.
+func (s *Server) goAway() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closing = true
 
-// TODO
-func (s *Server) handleUpgradeControl(req *httpcore.Request) error {
-	if !req.ConnectionUpgrade {
-		return ErrMissingConnectionUpgrade
+	for wsc := range s.conns {
+		go wsc.Close(websocket.CloseGoingAway, "Server shutting down")
 	}
+}
+
+// trackConn adds or removes wsc, adding it ends its handshake.
+func (s *Server) trackConn(wsc *websocket.WebSocketConn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		s.conns[wsc] = struct{}{}
+		s.upgrading--
 
-	if req.Upgrade != "websocket" {
-		return ErrUnsupportedUpgrade
+		// Upgraded while shutting down
+		if s.closing {
+			go wsc.Close(websocket.CloseGoingAway, "Server shutting down")
+		}
+	} else {
+		delete(s.conns, wsc)
 	}
+}
+
+func (s *Server) countUpgrade(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.upgrading += delta
+}
 
-	slog.Info("Correct upgrade headers found")
+// connCount counts the WebSocket connections, upgrading ones included.
+func (s *Server) connCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return nil
+	return len(s.conns) + s.upgrading
 }
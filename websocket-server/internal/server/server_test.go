@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suman7383/networking-from-scratch/httpcore"
+	"github.com/suman7383/networking-from-scratch/websocket-server/internal/websocket"
+)
+
+// dialWebSocket opens a WebSocket connection to path on addr and
+// reads the handshake response.
+func dialWebSocket(t *testing.T, addr, path string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: localhost\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+
+	status, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(status, "HTTP/1.1 101 ") {
+		t.Fatalf("handshake: %q %v", status, err)
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line == "\r\n" {
+			return conn, br
+		}
+	}
+}
+
+func TestShutdownSendsGoingAway(t *testing.T) {
+	s := NewServer("")
+	s.HandleWebSocket("/ws/echo", func(w websocket.DataWriter, data []byte) {
+		w.Send(data, websocket.DataTypeText)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	conn, br := dialWebSocket(t, ln.Addr().String(), "/ws/echo")
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(br, head[:2]); err != nil {
+		t.Fatalf("reading close frame: %s", err)
+	}
+
+	if head[0] != 0x80|byte(websocket.OpClose) {
+		t.Fatalf("got first byte %#x, want a close frame", head[0])
+	}
+
+	payload := make([]byte, head[1])
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := binary.BigEndian.Uint16(payload); code != uint16(websocket.CloseGoingAway) {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the closing handshake", err)
+	default:
+	}
+
+	// Answer with a masked close frame echoing the code
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | byte(websocket.OpClose), 0x80 | 2}
+	frame = append(frame, mask...)
+	frame = append(frame, payload[0]^mask[0], payload[1]^mask[1])
+	conn.Write(frame)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("Shutdown returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return after the closing handshake")
+	}
+}
+
+func TestShutdownWaitsForUpgrades(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	s := NewServer("")
+	s.Upgrader.CheckOrigin = func(r *httpcore.Request) bool {
+		close(entered)
+		<-release
+
+		return true
+	}
+	s.HandleWebSocket("/ws/echo", func(w websocket.DataWriter, data []byte) {})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "GET /ws/echo HTTP/1.1\r\nHost: localhost\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	<-entered
+
+	if n := s.connCount(); n != 1 {
+		t.Fatalf("connCount = %d during the handshake, want 1", n)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	close(release)
+
+	// Upgraded while shutting down, the connection is told to go away
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	br := bufio.NewReader(conn)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading handshake: %s", err)
+		}
+
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil || head[0] != 0x80|byte(websocket.OpClose) {
+		t.Fatalf("Expected a close frame, got %#x %v", head[0], err)
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a connection still open", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Dropping the connection ends it
+	conn.Close()
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("Shutdown returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return once the connection was gone")
+	}
+}
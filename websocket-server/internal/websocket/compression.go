@@ -0,0 +1,270 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// permessage-deflate (RFC 7692) compresses each message with DEFLATE.
+// The first frame of a compressed message has RSV1 set, the payload
+// of all its frames together is the compressed data minus the final
+// 0x00 0x00 0xff 0xff of a sync flush.
+
+var swsek = "Sec-WebSocket-Extensions"
+
+// DefaultCompressionThreshold is the size under which messages are
+// sent uncompressed when Upgrader.CompressionThreshold is not set.
+const DefaultCompressionThreshold = 256
+
+var ErrBadCompressedData = errors.New("invalid compressed message")
+
+// deflateWindow is the window flate compresses with (2^15 bytes), so
+// it is the only server_max_window_bits we can honor.
+const deflateWindow = 1 << 15
+
+// syncFlushTail ends the data of a sync flush, it is removed from
+// compressed messages.
+var syncFlushTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// inflateTail is added to a compressed message to read it: the sync
+// flush tail and an empty final block, so flate ends with io.EOF.
+var inflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// deflateParams are the negotiated permessage-deflate parameters.
+type deflateParams struct {
+	serverNoContextTakeover bool // compress every message on its own
+	clientNoContextTakeover bool // the client compresses every message on its own
+}
+
+// negotiateDeflate picks the first permessage-deflate offer of the
+// Sec-WebSocket-Extensions values the server can accept, and returns
+// its parameters and the extension to answer with. Offers with
+// unknown, repeated or invalid parameters are declined.
+func negotiateDeflate(values []string) (params deflateParams, ext string, ok bool) {
+	for _, offer := range strings.Split(strings.Join(values, ","), ",") {
+		name, rest, _ := strings.Cut(offer, ";")
+		if strings.TrimSpace(name) != "permessage-deflate" {
+			continue
+		}
+
+		if params, ok := parseDeflateOffer(rest); ok {
+			ext = "permessage-deflate"
+
+			if params.serverNoContextTakeover {
+				ext += "; server_no_context_takeover"
+			}
+
+			if params.clientNoContextTakeover {
+				ext += "; client_no_context_takeover"
+			}
+
+			return params, ext, true
+		}
+	}
+
+	return deflateParams{}, "", false
+}
+
+// parseDeflateOffer parses the parameters of a permessage-deflate
+// offer (RFC 7692, section 7.1).
+func parseDeflateOffer(s string) (params deflateParams, ok bool) {
+	seen := make(map[string]bool)
+
+	for _, p := range strings.Split(s, ";") {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+
+		k, v, hasValue := strings.Cut(p, "=")
+		k = strings.TrimSpace(k)
+		v = strings.Trim(strings.TrimSpace(v), `"`)
+
+		if seen[k] {
+			return deflateParams{}, false
+		}
+
+		seen[k] = true
+
+		switch k {
+		case "server_no_context_takeover":
+			if hasValue {
+				return deflateParams{}, false
+			}
+
+			params.serverNoContextTakeover = true
+		case "client_no_context_takeover":
+			if hasValue {
+				return deflateParams{}, false
+			}
+
+			params.clientNoContextTakeover = true
+		case "server_max_window_bits":
+			// flate always uses a 32 KiB window
+			if bits, valid := windowBits(v); !valid || bits != 15 {
+				return deflateParams{}, false
+			}
+		case "client_max_window_bits":
+			// The value is optional, we inflate with a 32 KiB window
+			// so any client window works
+			if _, valid := windowBits(v); hasValue && !valid {
+				return deflateParams{}, false
+			}
+		default:
+			return deflateParams{}, false
+		}
+	}
+
+	return params, true
+}
+
+// windowBits parses a max window bits value, 8 to 15.
+func windowBits(v string) (int, bool) {
+	bits, err := strconv.Atoi(v)
+	if err != nil || bits < 8 || bits > 15 || strconv.Itoa(bits) != v {
+		return 0, false
+	}
+
+	return bits, true
+}
+
+// deflateDst passes the output of the connection's flate.Writer to
+// the message being written. The flate.Writer outlives messages to
+// keep its context, so its destination can't change.
+type deflateDst struct {
+	mw *messageWriter
+}
+
+func (d *deflateDst) Write(p []byte) (int, error) {
+	return d.mw.writeCompressed(p)
+}
+
+// startCompression sends the rest of the message compressed,
+// starting with the data held until the threshold was reached.
+func (mw *messageWriter) startCompression() {
+	c := mw.c
+
+	if c.deflater == nil {
+		c.deflateDst = &deflateDst{}
+		c.deflater, _ = flate.NewWriter(c.deflateDst, flate.DefaultCompression)
+	}
+
+	c.deflateDst.mw = mw
+
+	mw.compressing = true
+	mw.rsv1 = true
+
+	pending := mw.pending
+	mw.pending = nil
+
+	if _, err := c.deflater.Write(pending); err != nil && mw.err == nil {
+		mw.err = err
+	}
+}
+
+// writeCompressed frames compressed data, always holding back the
+// last 4 bytes: at the end of the message they are the sync flush
+// tail, which is not sent.
+func (mw *messageWriter) writeCompressed(p []byte) (int, error) {
+	mw.held = append(mw.held, p...)
+
+	if n := len(mw.held) - len(syncFlushTail); n > 0 {
+		mw.writeFrames(mw.held[:n])
+		mw.held = append(mw.held[:0], mw.held[n:]...)
+	}
+
+	return len(p), mw.err
+}
+
+// finishCompression flushes the compressed message and drops the
+// sync flush tail.
+func (mw *messageWriter) finishCompression() {
+	c := mw.c
+
+	if err := c.deflater.Flush(); err != nil && mw.err == nil {
+		mw.err = err
+	}
+
+	if mw.err == nil && !bytes.Equal(mw.held, syncFlushTail) {
+		mw.err = ErrBadCompressedData
+	}
+
+	mw.held = nil
+
+	if c.deflate.serverNoContextTakeover {
+		c.deflater.Reset(c.deflateDst)
+	}
+}
+
+// inflateReader decompresses a message read by a messageReader.
+type inflateReader struct {
+	c    *WebSocketConn
+	mr   *messageReader
+	r    io.ReadCloser
+	size int64 // decompressed so far
+	err  error
+}
+
+// inflate returns a reader over the decompressed payload of mr. The
+// window of the previous messages is the dictionary, unless the
+// client compresses every message on its own.
+func (w *WebSocketConn) inflate(mr *messageReader) io.Reader {
+	src := io.MultiReader(mr, bytes.NewReader(inflateTail))
+
+	var dict []byte
+	if !w.deflate.clientNoContextTakeover {
+		dict = w.inflateWindow
+	}
+
+	if w.inflater == nil {
+		w.inflater = flate.NewReaderDict(src, dict)
+	} else {
+		w.inflater.(flate.Resetter).Reset(src, dict)
+	}
+
+	return &inflateReader{c: w, mr: mr, r: w.inflater}
+}
+
+func (ir *inflateReader) Read(p []byte) (int, error) {
+	if ir.err != nil {
+		return 0, ir.err
+	}
+
+	n, err := ir.r.Read(p)
+
+	ir.size += int64(n)
+	if ir.size > ir.c.maxMessageSize {
+		ir.err = ir.mr.fail(ErrMessageTooBig, CloseMessageTooBig)
+
+		return 0, ir.err
+	}
+
+	if !ir.c.deflate.clientNoContextTakeover {
+		ir.c.keepWindow(p[:n])
+	}
+
+	switch {
+	case err == nil || err == io.EOF:
+		ir.err = err
+	case err == io.ErrUnexpectedEOF || errors.Is(err, ErrMessageInterrupted) || errors.Is(err, ErrMessageTooBig):
+		// The message reader already failed
+		ir.err = err
+	default:
+		ir.err = ir.mr.fail(ErrBadCompressedData, CloseProtocolErr)
+	}
+
+	return n, ir.err
+}
+
+// keepWindow appends p to the last 32 KiB of decompressed data.
+func (w *WebSocketConn) keepWindow(p []byte) {
+	w.inflateWindow = append(w.inflateWindow, p...)
+
+	if extra := len(w.inflateWindow) - deflateWindow; extra > 0 {
+		w.inflateWindow = append(w.inflateWindow[:0], w.inflateWindow[extra:]...)
+	}
+}
@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suman7383/networking-from-scratch/httpcore"
+)
+
+func TestNegotiateDeflate(t *testing.T) {
+	for _, tc := range []struct {
+		offer string
+		ext   string
+		ok    bool
+	}{
+		{"permessage-deflate", "permessage-deflate", true},
+		{"permessage-deflate; client_max_window_bits", "permessage-deflate", true},
+		{"permessage-deflate; client_max_window_bits=10", "permessage-deflate", true},
+		{"permessage-deflate; server_max_window_bits=15", "permessage-deflate", true},
+		{
+			"permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+			"permessage-deflate; server_no_context_takeover; client_no_context_takeover", true,
+		},
+		// Falls back to the next offer
+		{"permessage-deflate; server_max_window_bits=10, permessage-deflate", "permessage-deflate", true},
+		{"x-webkit-deflate-frame, permessage-deflate", "permessage-deflate", true},
+		{"x-webkit-deflate-frame", "", false},
+		{"permessage-deflate; client_max_window_bits=16", "", false},
+		{"permessage-deflate; client_max_window_bits=010", "", false},
+		{"permessage-deflate; server_no_context_takeover; server_no_context_takeover", "", false},
+		{"permessage-deflate; server_no_context_takeover=1", "", false},
+		{"permessage-deflate; unknown", "", false},
+	} {
+		_, ext, ok := negotiateDeflate([]string{tc.offer})
+		if ext != tc.ext || ok != tc.ok {
+			t.Errorf("%q: got %q %v, want %q %v", tc.offer, ext, ok, tc.ext, tc.ok)
+		}
+	}
+}
+
+// deflateClient compresses and decompresses messages like a client
+// with context takeover.
+type deflateClient struct {
+	buf    bytes.Buffer
+	w      *flate.Writer
+	window []byte
+}
+
+func (c *deflateClient) compress(t *testing.T, s string) []byte {
+	if c.w == nil {
+		c.w, _ = flate.NewWriter(&c.buf, flate.BestCompression)
+	}
+
+	c.buf.Reset()
+	c.w.Write([]byte(s))
+	c.w.Flush()
+
+	b := c.buf.Bytes()
+	if len(b) > 125+4 {
+		t.Fatalf("compressed message too long for the test: %d bytes", len(b))
+	}
+
+	return bytes.Clone(b[:len(b)-4])
+}
+
+func (c *deflateClient) decompress(t *testing.T, payload []byte) string {
+	r := flate.NewReaderDict(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(inflateTail)), c.window)
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompressing: %s", err)
+	}
+
+	c.window = append(c.window, b...)
+
+	return string(b)
+}
+
+// maskedCompressed builds a masked text frame with RSV1 set.
+func maskedCompressed(payload []byte) string {
+	mask := [4]byte{5, 6, 7, 8}
+
+	b := []byte{0xC1, 0x80 | byte(len(payload))}
+	b = append(b, mask[:]...)
+
+	for i := range payload {
+		b = append(b, payload[i]^mask[i%4])
+	}
+
+	return string(b)
+}
+
+// readRawFrame reads an unmasked frame of up to 64 KiB.
+func readRawFrame(t *testing.T, br *bufio.Reader) (head byte, payload []byte) {
+	t.Helper()
+
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(br, b); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+
+	n := int(b[1] & 0x7f)
+	if n == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(br, ext)
+		n = int(binary.BigEndian.Uint16(ext))
+	}
+
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+
+	return b[0], payload
+}
+
+func TestCompressedMessages(t *testing.T) {
+	upgrader := Upgrader{EnableCompression: true}
+
+	router := httpcore.NewRouter()
+	router.Handle("GET /ws", upgrader.Handler(func(w DataWriter, data []byte) {
+		w.Send(data, DataTypeText)
+	}))
+
+	addr := serveTestRouter(t, router)
+
+	doc := `{"items": [` + strings.Repeat(`{"name": "item", "tags": ["a", "b"]}, `, 40) + `{}]}`
+
+	var client deflateClient
+
+	conn, br := dialTest(t, addr, upgradeRequest("/ws", "Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var ext string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading handshake: %s", err)
+		}
+
+		if v, ok := strings.CutPrefix(line, "Sec-WebSocket-Extensions: "); ok {
+			ext = strings.TrimSpace(v)
+		}
+
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	if ext != "permessage-deflate" {
+		t.Fatalf("Expected permessage-deflate to be accepted, got %q", ext)
+	}
+
+	// The second message is compressed with the context of the first,
+	// both ways
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte(maskedCompressed(client.compress(t, doc))))
+
+		head, payload := readRawFrame(t, br)
+		if head != 0xC1 {
+			t.Fatalf("Expected a compressed text frame, got %#x", head)
+		}
+
+		if got := client.decompress(t, payload); got != doc {
+			t.Fatalf("Expected the document back, got %q", got)
+		}
+
+		if len(payload) >= len(doc)/4 {
+			t.Errorf("Expected the document to be compressed, got %d bytes", len(payload))
+		}
+	}
+
+	// Short messages are sent as they are
+	conn.Write([]byte(maskedCompressed(client.compress(t, "hi"))))
+
+	if head, payload := readRawFrame(t, br); head != 0x81 || string(payload) != "hi" {
+		t.Errorf("Expected an uncompressed text frame, got %#x %q", head, payload)
+	}
+
+	// Without the extension, RSV1 is a protocol error
+	conn, br = dialTest(t, addr, upgradeRequest("/ws", "")+maskedCompressed(client.compress(t, "hi")))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	skipHandshake(t, br)
+
+	if code := readCloseCode(t, br); code != CloseProtocolErr {
+		t.Errorf("Expected close code %d, got %d", CloseProtocolErr, code)
+	}
+}
+
+func TestCompressedMessagesNoContextTakeover(t *testing.T) {
+	var buf bytes.Buffer
+
+	c := &WebSocketConn{
+		w:                 NewFrameWriter(&buf),
+		compress:          true,
+		compressThreshold: 1,
+		deflate:           deflateParams{serverNoContextTakeover: true},
+	}
+
+	doc := strings.Repeat("hello websocket ", 20)
+
+	// Every message compresses to the same frame without context
+	c.Send([]byte(doc), DataTypeText)
+	first := bytes.Clone(buf.Bytes())
+
+	buf.Reset()
+	c.Send([]byte(doc), DataTypeText)
+
+	if !bytes.Equal(first, buf.Bytes()) {
+		t.Errorf("Expected the same frame twice, got %x and %x", first, buf.Bytes())
+	}
+
+	var client deflateClient
+
+	_, payload := readRawFrame(t, bufio.NewReader(bytes.NewReader(first)))
+	if got := client.decompress(t, payload); got != doc {
+		t.Errorf("Expected the message back, got %q", got)
+	}
+}
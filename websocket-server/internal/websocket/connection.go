@@ -1,12 +1,14 @@
 package websocket
 
 import (
+	"compress/flate"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/suman7383/networking-from-scratch/websocket-server/utils"
@@ -14,12 +16,18 @@ import (
 
 type HandlerFunc func(w DataWriter, data []byte)
 
+// StreamHandlerFunc reads and writes the messages of a connection
+// itself, see WebSocketConn.HandleStream.
+type StreamHandlerFunc func(c *WebSocketConn)
+
 // Calls the handler function
 func (h HandlerFunc) CallFn(w DataWriter, data []byte) {
 	h(w, data)
 }
 
 type WebSocketConn struct {
+	mu sync.Mutex // guards closeSent and closed
+
 	conn         net.Conn
 	r            *FrameReader
 	w            *FrameWriter
@@ -28,46 +36,167 @@ type WebSocketConn struct {
 	closeCh      chan struct{}
 	closed       bool // Whether the TCP conn is closed
 	hander       HandlerFunc
+
+	idleTimeout time.Duration // waiting for the next frame
+	readTimeout time.Duration // reading a frame once it started
+
+	subprotocol string // selected in the handshake
+
+	maxMessageSize int64
+	reader         io.Reader // message being read
+	readErr        error     // final read error, returned by every later read
+
+	// permessage-deflate, when negotiated
+	compress          bool
+	compressThreshold int
+	deflate           deflateParams
+	deflater          *flate.Writer // compression context, kept across messages
+	deflateDst        *deflateDst
+	inflater          io.ReadCloser
+	inflateWindow     []byte // last 32 KiB received, context of the next message
+}
+
+// DefaultMaxMessageSize limits reassembled messages when
+// Upgrader.MaxMessageSize is not set.
+const DefaultMaxMessageSize = 1 << 20 // 1 MiB
+
+var ErrMessageTooBig = errors.New("message too big")
+var ErrUnexpectedContinuation = errors.New("continuation frame outside of a fragmented message")
+var ErrMessageInterrupted = errors.New("new message started before the previous one ended")
+
+// DefaultIdleTimeout is how long a connection may go without a frame
+// when Upgrader.IdleTimeout is not set.
+const DefaultIdleTimeout = 60 * time.Second
+
+// DefaultReadTimeout is how long reading one frame may take when
+// Upgrader.ReadTimeout is not set.
+const DefaultReadTimeout = 10 * time.Second
+
+var ErrIdleTimeout = errors.New("connection idle for too long")
+var ErrFrameTimeout = errors.New("timeout reading frame")
+
+// Subprotocol returns the application protocol selected in the
+// handshake, or "" if none was.
+func (w *WebSocketConn) Subprotocol() string {
+	return w.subprotocol
 }
 
-// TODO
+// Handle reads messages until the connection is closed and passes
+// each of them, whole, to the connection's HandlerFunc.
 func (w *WebSocketConn) Handle() {
 	defer func() {
-		if !w.closed {
-			w.closeTCPConn()
+		w.closeTCPConn()
+
+		slog.Info("CLIENT disconnected", slog.String("Addr", w.conn.RemoteAddr().String()))
+	}()
+
+	for {
+		_, r, err := w.NextReader()
+		if err != nil {
+			return
 		}
 
+		// On errors the closing handshake already started, the next
+		// call returns once it is done
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+
+		// Handle this data to user(application layer) to handle
+		if !w.closing() {
+			w.hander.CallFn(w, msg)
+		}
+	}
+}
+
+// HandleStream passes the connection to fn, which reads and writes
+// messages itself with NextReader and NextWriter. Once fn returns,
+// the closing handshake is completed, with CloseNormal if fn did not
+// start it, and the connection is closed.
+func (w *WebSocketConn) HandleStream(fn StreamHandlerFunc) {
+	defer func() {
+		w.closeTCPConn()
+
 		slog.Info("CLIENT disconnected", slog.String("Addr", w.conn.RemoteAddr().String()))
 	}()
 
-	// Handles errors on readers, writers
-	go w.readWriteError()
+	fn(w)
+
+	w.initiateClose(CloseNormal, CloseNormal.String())
+
+	// Wait for the client's close frame
+	for {
+		if _, _, err := w.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// nextDataFrame reads frames until a data frame arrives. Control
+// frames are answered on the way, so they can come between two
+// fragments of a message (RFC 6455, section 5.4).
+//
+// Errors it returns are final: the connection is closed, io.EOF
+// means after a closing handshake.
+func (w *WebSocketConn) nextDataFrame() (*Frame, error) {
+	if w.readErr != nil {
+		return nil, w.readErr
+	}
 
 	// Read for incoming frames
 	for {
 
-		if w.closed {
-			return
+		if w.isClosed() {
+			return nil, w.readFailed(io.EOF)
 		}
 
-		fr, err := w.r.ReadFrame()
+		fr, err := w.readFrame()
 		if err != nil {
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
+				return nil, w.readFailed(io.EOF)
+			}
+
+			// The rest of the stream can't be trusted after a timeout,
+			// say goodbye and drop the connection
+			if errors.Is(err, ErrIdleTimeout) {
+				slog.Info(err.Error(), slog.String("Addr", w.conn.RemoteAddr().String()))
+				w.initiateClose(CloseGoingAway, "Idle timeout")
+
+				return nil, w.readFailed(err)
+			}
+
+			// The payload of a frame that is too large is never read
+			if errors.Is(err, ErrPayloadTooLarge) {
+				utils.LogErr("closing client "+w.conn.RemoteAddr().String(), err)
+				w.initiateClose(CloseMessageTooBig, CloseMessageTooBig.String())
+
+				return nil, w.readFailed(err)
+			}
+
+			if errors.Is(err, ErrFrameTimeout) {
+				utils.LogErr("closing slow client "+w.conn.RemoteAddr().String(), err)
+				w.initiateClose(ClosePolicyViolation, "Frame timeout")
+
+				return nil, w.readFailed(err)
 			}
 			// Send Close control frame with error status
 			utils.LogErr("reading frame error", err)
 
-			if w.closed {
-				return
+			if w.isClosed() {
+				return nil, w.readFailed(io.EOF)
 			}
 
 			w.initiateClose(CloseProtocolErr, CloseProtocolErr.String())
 			continue
 		}
 
-		// FOR DEBUGGING
-		printFrame(fr)
+		slog.Debug("frame received",
+			slog.String("opcode", fr.Opcode.String()),
+			slog.Bool("fin", fr.Fin),
+			slog.Bool("rsv1", fr.Rsv1),
+			slog.Uint64("len", fr.PayloadLen),
+		)
 
 		switch fr.Opcode {
 		case OpPing:
@@ -87,19 +216,18 @@ func (w *WebSocketConn) Handle() {
 			//
 			// If CLOSE frame is not already sent by server
 			// we send CLOSE FRAME
-			if !w.closeSent {
-				w.sendCloseFrame()
-			} else {
+			if !w.sendCloseFrame() {
 				w.closeReceived()
 			}
 
-			return
-		case OpContinuation:
-			// Send CLOSE FRAME
-			w.initiateClose(CloseProtocolErr, "Fragmentation unsupported")
-		case OpText, OpBinary:
-			// Handle this data to user(application layer) to handle
-			w.hander.CallFn(w.w, fr.Payload)
+			return nil, w.readFailed(io.EOF)
+		case OpText, OpBinary, OpContinuation:
+			// Messages arriving after a close frame was sent are dropped
+			if w.closing() {
+				continue
+			}
+
+			return fr, nil
 		default:
 			// CONTROL SHOULD NEVER REACH HERE
 			// Send close frame
@@ -109,17 +237,43 @@ func (w *WebSocketConn) Handle() {
 	}
 }
 
-func (w *WebSocketConn) readWriteError() {
+// readFailed records err as the final read error and closes the TCP
+// connection.
+func (w *WebSocketConn) readFailed(err error) error {
+	w.readErr = err
+	w.closeTCPConn()
+
+	return err
+}
+
+// readFrame waits up to the idle timeout for the next frame, then
+// up to the read timeout for the whole frame.
+func (w *WebSocketConn) readFrame() (*Frame, error) {
+	w.conn.SetReadDeadline(time.Now().Add(w.idleTimeout))
+
+	if _, err := w.r.r.Peek(1); err != nil {
+		if isTimeout(err) {
+			return nil, ErrIdleTimeout
+		}
+
+		return nil, err
+	}
+
+	w.conn.SetReadDeadline(time.Now().Add(w.readTimeout))
 
-	select {
-	case <-w.r.closeCh:
-		slog.Info("Closing due to read error")
-		w.initiateClose(CloseInternalError, CloseInternalError.String())
-	case <-w.w.closeCh:
-		slog.Info("Closing due to write error")
-		w.initiateClose(CloseInternalError, CloseInternalError.String())
+	fr, err := w.r.ReadFrame()
+	if isTimeout(err) {
+		return nil, fmt.Errorf("%w: %w", ErrFrameTimeout, err)
 	}
 
+	return fr, err
+}
+
+// isTimeout reports whether err is a deadline being exceeded.
+func isTimeout(err error) bool {
+	var ne net.Error
+
+	return errors.As(err, &ne) && ne.Timeout()
 }
 
 // Marks closeReceived to true and sends signal to "close" channel
@@ -131,13 +285,27 @@ func (w *WebSocketConn) closeReceived() {
 
 const DEFAULT_CLOSE_TIMEOUT = 5 * time.Second
 
+// Close starts the closing handshake with code and reason. The TCP
+// connection is closed once the client answers, or after
+// DEFAULT_CLOSE_TIMEOUT.
+//
+// It is safe to call from any goroutine, e.g. with CloseGoingAway
+// when the server shuts down.
+func (w *WebSocketConn) Close(code CloseStatus, reason string) {
+	w.initiateClose(code, reason)
+}
+
+// Terminate closes the TCP connection without a closing handshake.
+func (w *WebSocketConn) Terminate() {
+	w.closeTCPConn()
+}
+
 func (w *WebSocketConn) initiateClose(code CloseStatus, reason string) {
-	if w.closeSent || w.closed {
+	if !w.markCloseSent() {
 		return
 	}
 
-	w.sendErrCloseFrame(code, reason)
-	w.closeSent = true
+	w.w.WriteFrame(CloseFrame(code, []byte(reason)))
 
 	// Wait for client close frame or timeout
 	go func() {
@@ -152,35 +320,71 @@ func (w *WebSocketConn) initiateClose(code CloseStatus, reason string) {
 }
 
 func (w *WebSocketConn) closeTCPConn() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
 	w.conn.Close()
 	w.closed = true
 }
 
+// closing reports whether the closing handshake started.
+func (w *WebSocketConn) closing() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.closeSent || w.closed
+}
+
+func (w *WebSocketConn) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.closed
+}
+
+// markCloseSent reports false if a close frame was already sent
+// (or the connection is closed), so only one is ever sent.
+func (w *WebSocketConn) markCloseSent() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closeSent || w.closed {
+		return false
+	}
+
+	w.closeSent = true
+
+	return true
+}
+
 var ErrConnectionClosing = errors.New("Writes closed, connection closing")
 
 func (w *WebSocketConn) writeFrame(f *Frame) error {
-	if w.closeSent || w.closed {
+	w.mu.Lock()
+	closing := w.closeSent || w.closed
+	w.mu.Unlock()
+
+	if closing {
 		return ErrConnectionClosing
 	}
 
 	return w.w.WriteFrame(f)
 }
 
-func (w *WebSocketConn) sendErrCloseFrame(code CloseStatus, reason string) {
-	if w.closeSent {
-		return
+// sendCloseFrame answers the client's close frame. It reports false
+// if the server already sent one.
+func (w *WebSocketConn) sendCloseFrame() bool {
+	if !w.markCloseSent() {
+		return false
 	}
 
-	fr := CloseFrame(code, []byte(reason))
+	w.w.WriteFrame(CloseFrame(CloseNormal, []byte(CloseNormal.String())))
 
-	w.writeFrame(fr)
-}
-
-func (w *WebSocketConn) sendCloseFrame() {
-	frW := CloseFrame(CloseNormal, []byte(CloseNormal.String()))
-
-	w.writeFrame(frW)
-	w.closeSent = true
+	return true
 }
 
 type CloseStatus uint16
@@ -230,48 +434,16 @@ func CloseFrame(statusCode CloseStatus, reason []byte) *Frame {
 		binary.BigEndian.PutUint16(payload[:2], uint16(statusCode))
 		copy(payload[2:], reason)
 
-		fr.PayloadLen = uint16(len(payload))
+		fr.PayloadLen = uint64(len(payload))
 		fr.Payload = payload
 	} else {
 		// 2 bytes statusCode only
 		payload := make([]byte, 2)
 		binary.BigEndian.PutUint16(payload, uint16(statusCode))
 
-		fr.PayloadLen = uint16(len(payload))
+		fr.PayloadLen = uint64(len(payload))
 		fr.Payload = payload
 	}
 
 	return fr
 }
-
-// Prints the frame for debugging
-func printFrame(f *Frame) {
-	fmt.Println("====== WebSocket Frame ======")
-
-	fmt.Printf("FIN        : %v\n", f.Fin)
-	fmt.Printf("Opcode     : %v (%s)\n", f.Opcode, f.Opcode.String())
-	fmt.Printf("PayloadLen : %d\n", f.PayloadLen)
-	fmt.Printf("Masked     : %v\n", f.Masked)
-
-	if f.Masked {
-		fmt.Printf("Mask Key   : %02x %02x %02x %02x\n",
-			f.MaskKey[0],
-			f.MaskKey[1],
-			f.MaskKey[2],
-			f.MaskKey[3],
-		)
-	}
-
-	if len(f.Payload) == 0 {
-		fmt.Println("Payload    : <empty>")
-	} else {
-		fmt.Printf("Payload    : %q\n", f.Payload)
-		fmt.Printf("PayloadHex :")
-		for _, b := range f.Payload {
-			fmt.Printf(" %02x", b)
-		}
-		fmt.Println()
-	}
-
-	fmt.Println("=============================")
-}
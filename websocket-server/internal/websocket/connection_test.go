@@ -0,0 +1,296 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suman7383/networking-from-scratch/httpcore"
+)
+
+// skipHandshake reads the 101 response up to the first frame.
+func skipHandshake(t *testing.T, br *bufio.Reader) {
+	t.Helper()
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading handshake: %s", err)
+		}
+
+		if line == "\r\n" {
+			return
+		}
+	}
+}
+
+// readCloseCode reads a close frame and returns its status code.
+func readCloseCode(t *testing.T, br *bufio.Reader) CloseStatus {
+	t.Helper()
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		t.Fatalf("reading close frame: %s", err)
+	}
+
+	if head[0] != 0x80|byte(OpClose) {
+		t.Fatalf("Expected a close frame, got first byte %#x", head[0])
+	}
+
+	payload := make([]byte, head[1])
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("reading close frame: %s", err)
+	}
+
+	return CloseStatus(binary.BigEndian.Uint16(payload))
+}
+
+func TestReadTimeouts(t *testing.T) {
+	upgrader := Upgrader{
+		IdleTimeout: 50 * time.Millisecond,
+		ReadTimeout: 50 * time.Millisecond,
+	}
+
+	router := httpcore.NewRouter()
+	router.Handle("GET /ws", upgrader.Handler(func(w DataWriter, data []byte) {}))
+
+	addr := serveTestRouter(t, router)
+
+	for name, tc := range map[string]struct {
+		frames string
+		want   CloseStatus
+	}{
+		"idle": {"", CloseGoingAway},
+		// Only the first bytes of a frame ever arrive
+		"slow frame": {maskedText("hello")[:3], ClosePolicyViolation},
+	} {
+		conn, br := dialTest(t, addr, upgradeRequest("/ws", "")+tc.frames)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		skipHandshake(t, br)
+
+		if code := readCloseCode(t, br); code != tc.want {
+			t.Errorf("%s: close code %d, want %d", name, code, tc.want)
+		}
+
+		if _, err := br.ReadByte(); err != io.EOF && !strings.Contains(err.Error(), "reset") {
+			t.Errorf("%s: expected the connection to be closed, got %v", name, err)
+		}
+	}
+}
+
+// maskedFrame builds a masked frame as a client sends it.
+func maskedFrame(fin bool, op Opcode, payload string) string {
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+
+	mask := [4]byte{5, 6, 7, 8}
+
+	b := []byte{b0, 0x80 | byte(len(payload))}
+	b = append(b, mask[:]...)
+
+	for i := 0; i < len(payload); i++ {
+		b = append(b, payload[i]^mask[i%4])
+	}
+
+	return string(b)
+}
+
+// readServerFrame reads an unmasked frame of at most 125 bytes.
+func readServerFrame(t *testing.T, br *bufio.Reader) (Opcode, string) {
+	t.Helper()
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+
+	payload := make([]byte, head[1]&0x7f)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+
+	return Opcode(head[0] & 0x0f), string(payload)
+}
+
+func TestFragmentedMessages(t *testing.T) {
+	upgrader := Upgrader{MaxMessageSize: 16}
+
+	router := httpcore.NewRouter()
+	router.Handle("GET /ws", upgrader.Handler(func(w DataWriter, data []byte) {
+		w.Send(data, DataTypeText)
+	}))
+
+	addr := serveTestRouter(t, router)
+
+	// A ping between two fragments is answered right away
+	frames := maskedFrame(false, OpText, "hel") +
+		maskedFrame(true, OpPing, "p") +
+		maskedFrame(false, OpContinuation, "lo ") +
+		maskedFrame(true, OpContinuation, "world")
+
+	conn, br := dialTest(t, addr, upgradeRequest("/ws", "")+frames)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	skipHandshake(t, br)
+
+	if op, payload := readServerFrame(t, br); op != OpPong || payload != "p" {
+		t.Fatalf("Expected the pong first, got %s %q", op, payload)
+	}
+
+	if op, payload := readServerFrame(t, br); op != OpText || payload != "hello world" {
+		t.Fatalf("Expected the reassembled message, got %s %q", op, payload)
+	}
+
+	for name, tc := range map[string]struct {
+		frames string
+		want   CloseStatus
+	}{
+		"continuation without a message": {
+			maskedFrame(true, OpContinuation, "a"), CloseProtocolErr,
+		},
+		"new message before the end": {
+			maskedFrame(false, OpText, "a") + maskedFrame(true, OpText, "b"), CloseProtocolErr,
+		},
+		"fragmented control frame": {
+			maskedFrame(false, OpPing, "a"), CloseProtocolErr,
+		},
+		"message too big": {
+			maskedFrame(false, OpBinary, "0123456789") + maskedFrame(true, OpContinuation, "0123456789"), CloseMessageTooBig,
+		},
+	} {
+		conn, br := dialTest(t, addr, upgradeRequest("/ws", "")+tc.frames)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		skipHandshake(t, br)
+
+		if code := readCloseCode(t, br); code != tc.want {
+			t.Errorf("%s: close code %d, want %d", name, code, tc.want)
+		}
+	}
+}
+
+func TestLargeMessages(t *testing.T) {
+	upgrader := Upgrader{MaxFrameSize: 1 << 17}
+
+	router := httpcore.NewRouter()
+	router.Handle("GET /ws", upgrader.Handler(func(w DataWriter, data []byte) {
+		w.Send(data, DataTypeBinary)
+	}))
+
+	addr := serveTestRouter(t, router)
+
+	// 70000 bytes need a 64-bit length and come back in two fragments
+	payload := strings.Repeat("a", 70000)
+
+	conn, br := dialTest(t, addr, upgradeRequest("/ws", "")+string(frameHead(OpBinary, 70000))+payload)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	skipHandshake(t, br)
+
+	var got []byte
+
+	for _, want := range []struct {
+		head  byte
+		size  int
+		len16 bool
+	}{
+		{0x02, DefaultFragmentSize, false},
+		{0x80, 70000 - DefaultFragmentSize, true},
+	} {
+		head := make([]byte, 2)
+		io.ReadFull(br, head)
+
+		var n int
+		if want.len16 {
+			ext := make([]byte, 2)
+			io.ReadFull(br, ext)
+			n = int(binary.BigEndian.Uint16(ext))
+		} else {
+			ext := make([]byte, 8)
+			io.ReadFull(br, ext)
+			n = int(binary.BigEndian.Uint64(ext))
+		}
+
+		if head[0] != want.head || n != want.size {
+			t.Fatalf("got frame %#x of %d bytes, want %#x of %d bytes", head[0], n, want.head, want.size)
+		}
+
+		fragment := make([]byte, n)
+		if _, err := io.ReadFull(br, fragment); err != nil {
+			t.Fatalf("reading fragment: %s", err)
+		}
+
+		got = append(got, fragment...)
+	}
+
+	if string(got) != payload {
+		t.Error("Expected the message to be echoed back whole")
+	}
+
+	// A frame over MaxFrameSize is refused before its payload is sent
+	conn, br = dialTest(t, addr, upgradeRequest("/ws", "")+string(frameHead(OpBinary, 1<<20)))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	skipHandshake(t, br)
+
+	if code := readCloseCode(t, br); code != CloseMessageTooBig {
+		t.Errorf("Expected close code %d, got %d", CloseMessageTooBig, code)
+	}
+}
+
+func TestStreamingMessages(t *testing.T) {
+	var upgrader Upgrader
+
+	router := httpcore.NewRouter()
+	router.Handle("GET /ws", upgrader.StreamHandler(func(c *WebSocketConn) {
+		for {
+			dt, r, err := c.NextReader()
+			if err != nil {
+				return
+			}
+
+			// Answer the first bytes before the message is complete
+			head := make([]byte, 3)
+			if _, err := io.ReadFull(r, head); err != nil {
+				return
+			}
+
+			w, _ := c.NextWriter(dt)
+			w.Write(head)
+			w.Close()
+
+			w, _ = c.NextWriter(dt)
+			io.Copy(w, r)
+			w.Close()
+		}
+	}))
+
+	addr := serveTestRouter(t, router)
+
+	conn, br := dialTest(t, addr, upgradeRequest("/ws", "")+maskedFrame(false, OpText, "hel"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	skipHandshake(t, br)
+
+	if op, payload := readServerFrame(t, br); op != OpText || payload != "hel" {
+		t.Fatalf("Expected the first fragment to be answered, got %s %q", op, payload)
+	}
+
+	conn.Write([]byte(maskedFrame(true, OpPing, "p") + maskedFrame(true, OpContinuation, "lo world")))
+
+	if op, payload := readServerFrame(t, br); op != OpPong || payload != "p" {
+		t.Fatalf("Expected a pong, got %s %q", op, payload)
+	}
+
+	if op, payload := readServerFrame(t, br); op != OpText || payload != "lo world" {
+		t.Fatalf("Expected the rest of the message, got %s %q", op, payload)
+	}
+
+	// The handler returns when the client closes
+	conn.Write([]byte(maskedFrame(true, OpClose, "\x03\xe8")))
+
+	if code := readCloseCode(t, br); code != CloseNormal {
+		t.Errorf("Expected close code %d, got %d", CloseNormal, code)
+	}
+}
@@ -2,10 +2,11 @@ package websocket
 
 type Frame struct {
 	Fin        bool
+	Rsv1       bool // compressed message (permessage-deflate)
 	Opcode     Opcode
 	Masked     bool
 	MaskKey    [4]byte
-	PayloadLen uint16 // Support 2^16
+	PayloadLen uint64 // 7 bits, 16 bits or 63 bits on the wire
 	Payload    []byte
 }
 
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// frameHead builds the head of a masked client frame with a 64-bit
+// payload length, the mask key is all zeros.
+func frameHead(op Opcode, payloadLen uint64) []byte {
+	b := []byte{0x80 | byte(op), 0x80 | 127}
+	b = binary.BigEndian.AppendUint64(b, payloadLen)
+
+	return append(b, 0, 0, 0, 0)
+}
+
+func TestReadFrame64BitLength(t *testing.T) {
+	payload := strings.Repeat("a", 70000)
+
+	fr := NewFrameReader(bytes.NewReader(append(frameHead(OpBinary, 70000), payload...)))
+
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %s", err)
+	}
+
+	if f.PayloadLen != 70000 || string(f.Payload) != payload {
+		t.Errorf("Expected a 70000 bytes payload, got PayloadLen %d, %d bytes", f.PayloadLen, len(f.Payload))
+	}
+
+	for name, tc := range map[string]struct {
+		head []byte
+		want error
+	}{
+		"most significant bit set": {frameHead(OpBinary, 1<<63|70000), ErrProtocol},
+		"length fits in 16 bits":   {frameHead(OpBinary, 125), ErrProtocol},
+		"control frame":            {frameHead(OpPing, 70000), ErrProtocol},
+		"larger than the limit":    {frameHead(OpBinary, 1<<40), ErrPayloadTooLarge},
+	} {
+		fr := NewFrameReader(bytes.NewReader(tc.head))
+		fr.maxFrameSize = DefaultMaxFrameSize
+
+		if _, err := fr.ReadFrame(); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestWriteFrameLengths(t *testing.T) {
+	for _, n := range []int{125, 126, 0xFFFF, 0x10000} {
+		var buf bytes.Buffer
+
+		c := &WebSocketConn{w: NewFrameWriter(&buf)}
+		c.w.fragmentSize = n
+		c.Send(make([]byte, n), DataTypeBinary)
+
+		head := buf.Bytes()
+
+		var got uint64
+		switch head[1] {
+		case 126:
+			got = uint64(binary.BigEndian.Uint16(head[2:4]))
+		case 127:
+			got = binary.BigEndian.Uint64(head[2:10])
+		default:
+			got = uint64(head[1])
+		}
+
+		if head[0] != 0x82 || got != uint64(n) {
+			t.Errorf("%d bytes: got head %#x, length %d", n, head[0], got)
+		}
+	}
+}
+
+func TestMessageWriterFragments(t *testing.T) {
+	var buf bytes.Buffer
+
+	c := &WebSocketConn{w: NewFrameWriter(&buf)}
+	c.w.fragmentSize = 4
+
+	w, err := c.NextWriter(DataTypeText)
+	if err != nil {
+		t.Fatalf("NextWriter: %s", err)
+	}
+
+	for _, s := range []string{"hel", "lo wor", "ld!"} {
+		w.Write([]byte(s))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if _, err := w.Write([]byte("x")); err != ErrWriterClosed {
+		t.Errorf("Expected ErrWriterClosed, got %v", err)
+	}
+
+	// Exactly one buffer full, sent as a single final frame
+	w, _ = c.NextWriter(DataTypeBinary)
+	w.Write([]byte("abcd"))
+	w.Close()
+
+	br := bufio.NewReader(&buf)
+
+	for _, want := range []struct {
+		head    byte
+		payload string
+	}{
+		{0x01, "hell"}, // TEXT, FIN = 0
+		{0x00, "o wo"}, // CONTINUATION, FIN = 0
+		{0x80, "rld!"}, // CONTINUATION, FIN = 1
+		{0x82, "abcd"}, // BINARY, FIN = 1
+	} {
+		head, _ := br.ReadByte()
+		n, _ := br.ReadByte()
+
+		payload := make([]byte, n)
+		br.Read(payload)
+
+		if head != want.head || string(payload) != want.payload {
+			t.Errorf("got frame %#x %q, want %#x %q", head, payload, want.head, want.payload)
+		}
+	}
+}
@@ -1,70 +1,354 @@
 package websocket
 
 import (
+	"bufio"
 	"crypto/sha1"
 	"encoding/base64"
 	"errors"
-	"net"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/suman7383/networking-from-scratch/websocket-server/internal/httpcore"
-	"github.com/suman7383/networking-from-scratch/websocket-server/utils"
+	"github.com/suman7383/networking-from-scratch/httpcore"
 )
 
 var ErrBadHandshake = errors.New("Bad handshake")
 var ErrClientVersion = errors.New("Unsupported version")
+var ErrUpgradeMethod = errors.New("WebSocket upgrade must be a GET request")
+var ErrMissingConnectionUpgrade = errors.New("Missing Connection upgrade header")
+var ErrUnsupportedUpgrade = errors.New("Provided upgrade not support")
+var ErrBadOrigin = errors.New("Origin not allowed")
+var ErrNoSubprotocol = errors.New("No supported subprotocol")
 
 var guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
 
 var swsvk = "Sec-WebSocket-Version"
 var swsak = "Sec-WebSocket-Accept"
 var swsk = "Sec-WebSocket-Key"
+var swspk = "Sec-WebSocket-Protocol"
 
-func HandleHandshake(req *httpcore.Request, conn net.Conn, handler HandlerFunc) (WebsocketConn *WebSocketConn, err error) {
-	// TODO: Validate WebSocket-only headers\
-	key, err := validateHeaders(req)
+// Upgrader turns HTTP requests into WebSocket connections, so a
+// WebSocket endpoint can be mounted as an ordinary route:
+//
+//	var upgrader websocket.Upgrader
+//	router.Handle("GET /ws/chat", upgrader.Handler(chat))
+type Upgrader struct {
+	// CheckOrigin reports whether the request's Origin may open a
+	// connection. Browsers send any page's origin, so this is what
+	// stops other sites from talking to the endpoint.
+	//
+	// If nil, requests without an Origin (non-browser clients) and
+	// requests whose Origin host matches the Host are accepted.
+	CheckOrigin func(r *httpcore.Request) bool
+
+	// IdleTimeout is how long a connection may go without a frame
+	// from the client. Clients keep quiet connections open with pings.
+	//
+	// If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// ReadTimeout is how long a client may take to send a frame once
+	// its first byte arrived.
+	//
+	// If zero, DefaultReadTimeout is used.
+	ReadTimeout time.Duration
+
+	// MaxMessageSize limits the size of a message, all of its
+	// fragments together. Larger messages close the connection with
+	// CloseMessageTooBig.
+	//
+	// If zero, DefaultMaxMessageSize is used.
+	MaxMessageSize int64
+
+	// MaxFrameSize limits the payload of a single frame. Larger
+	// frames close the connection with CloseMessageTooBig before
+	// their payload is read.
+	//
+	// If zero, DefaultMaxFrameSize is used.
+	MaxFrameSize int64
+
+	// EnableCompression accepts the permessage-deflate extension
+	// (RFC 7692) when the client offers it. Each connection then
+	// compresses with its own context, carried from one message to
+	// the next unless the client asked for server_no_context_takeover.
+	EnableCompression bool
+
+	// CompressionThreshold is the message size under which messages
+	// are sent uncompressed, compressing them costs more than it saves.
+	//
+	// If zero, DefaultCompressionThreshold is used.
+	CompressionThreshold int
+
+	// Subprotocols lists the application protocols the server speaks,
+	// in order of preference. The first one the client also offers in
+	// Sec-WebSocket-Protocol is selected, see WebSocketConn.Subprotocol.
+	Subprotocols []string
+
+	// RequireSubprotocol rejects handshakes without a protocol from
+	// Subprotocols with 400 Bad Request. Otherwise they are accepted
+	// and no protocol is selected.
+	RequireSubprotocol bool
+}
+
+// Upgrade completes the opening handshake (RFC 6455, section 4.2)
+// and takes the connection over from the HTTP server.
+//
+// If the request is not a valid upgrade, it has already been
+// answered with an HTTP error when Upgrade returns the error.
+//
+// handler receives the messages when the connection is served with
+// Handle, it may be nil for HandleStream.
+func (u *Upgrader) Upgrade(w httpcore.ResponseWriter, r *httpcore.Request, handler HandlerFunc) (*WebSocketConn, error) {
+	key, err := u.validateRequest(r)
 	if err != nil {
-		// Send HTTP error response
-		utils.WriteErrResponse(conn, httpcore.StatusBadRequest, err.Error())
+		writeHandshakeError(w, err)
+		return nil, err
+	}
+
+	protocol := u.selectSubprotocol(r)
+	if len(protocol) == 0 && u.RequireSubprotocol {
+		writeHandshakeError(w, ErrNoSubprotocol)
+		return nil, ErrNoSubprotocol
+	}
 
+	hj, ok := w.(httpcore.Hijacker)
+	if !ok {
+		w.WriteHeader(httpcore.StatusInternalServerError)
+		return nil, httpcore.ErrNotHijackable
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
 		return nil, err
 	}
 
 	// Compute Sec-WebSocket-Accept
 	swsa := computeWebsocketAccept(key)
 
+	var deflate deflateParams
+	var ext string
+	var compress bool
+
+	if u.EnableCompression {
+		deflate, ext, compress = negotiateDeflate(r.Header.Values(swsek))
+	}
+
 	// Write 101 Switching Protocols response
-	sendSwitchingProtoResponse(swsa, conn)
+	if err := sendSwitchingProtoResponse(swsa, protocol, ext, brw.Writer, r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Take ownership of the connection and create WebsocketConn.
+	// Frames are read through the HTTP server's buffer, which may
+	// already hold the first ones.
+	fr := NewFrameReader(brw.Reader)
+	fr.maxFrameSize = u.maxFrameSize()
+	fr.allowRsv1 = compress
 
-	// Take ownership of the connection and create WebsocketConn
 	wsc := &WebSocketConn{
 		conn:         conn,
-		r:            NewFrameReader(conn),
-		w:            NewFrameWriter(conn),
+		r:            fr,
+		w:            NewFrameWriter(brw.Writer),
 		hander:       handler,
 		closeCh:      make(chan struct{}),
 		closeSent:    false,
 		closeReceive: false,
 		closed:       false,
+
+		idleTimeout: orDefault(u.IdleTimeout, DefaultIdleTimeout),
+		readTimeout: orDefault(u.ReadTimeout, DefaultReadTimeout),
+
+		maxMessageSize: u.maxMessageSize(),
+		subprotocol:    protocol,
+
+		compress:          compress,
+		compressThreshold: u.compressionThreshold(),
+		deflate:           deflate,
 	}
 
 	return wsc, nil
 }
 
+// Handler returns an HTTP handler that upgrades every request and
+// passes the messages of the connection to handler.
+func (u *Upgrader) Handler(handler HandlerFunc) httpcore.Handler {
+	return httpcore.HandlerFunc(func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		wsc, err := u.Upgrade(w, r, handler)
+		if err != nil {
+			return
+		}
+
+		// Pass the control to WebSocket handler
+		wsc.Handle()
+	})
+}
+
+// StreamHandler returns an HTTP handler that upgrades every request
+// and lets fn read and write the messages of the connection itself.
+func (u *Upgrader) StreamHandler(fn StreamHandlerFunc) httpcore.Handler {
+	return httpcore.HandlerFunc(func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		wsc, err := u.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		wsc.HandleStream(fn)
+	})
+}
+
+func (u *Upgrader) maxMessageSize() int64 {
+	if u.MaxMessageSize > 0 {
+		return u.MaxMessageSize
+	}
+
+	return DefaultMaxMessageSize
+}
+
+func (u *Upgrader) maxFrameSize() uint64 {
+	if u.MaxFrameSize > 0 {
+		return uint64(u.MaxFrameSize)
+	}
+
+	return DefaultMaxFrameSize
+}
+
+func (u *Upgrader) compressionThreshold() int {
+	if u.CompressionThreshold > 0 {
+		return u.CompressionThreshold
+	}
+
+	return DefaultCompressionThreshold
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+
+	return def
+}
+
+// validateRequest checks the upgrade request and returns its
+// Sec-WebSocket-Key.
+func (u *Upgrader) validateRequest(r *httpcore.Request) (key string, err error) {
+	if r.Method != httpcore.MethodGet {
+		return "", ErrUpgradeMethod
+	}
+
+	// Browsers may send "Connection: keep-alive, Upgrade"
+	if !r.Header.HasToken("Connection", "upgrade") {
+		return "", ErrMissingConnectionUpgrade
+	}
+
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return "", ErrUnsupportedUpgrade
+	}
+
+	if key, err = validateHeaders(r); err != nil {
+		return "", err
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+
+	if !checkOrigin(r) {
+		return "", ErrBadOrigin
+	}
+
+	return key, nil
+}
+
+// selectSubprotocol returns the first of u.Subprotocols offered by
+// the client, or "" if there is none (RFC 6455, section 4.2.2).
+// Protocol names are compared as is, they are case-sensitive.
+func (u *Upgrader) selectSubprotocol(r *httpcore.Request) string {
+	var offered []string
+
+	for _, v := range r.Header.Values(swspk) {
+		for _, p := range strings.Split(v, ",") {
+			offered = append(offered, strings.TrimSpace(p))
+		}
+	}
+
+	for _, p := range u.Subprotocols {
+		if slices.Contains(offered, p) {
+			return p
+		}
+	}
+
+	return ""
+}
+
+// writeHandshakeError answers a rejected upgrade request.
+func writeHandshakeError(w httpcore.ResponseWriter, err error) {
+	switch err {
+	case ErrUpgradeMethod:
+		w.Header().Set("Allow", httpcore.MethodGet)
+		w.WriteHeader(httpcore.StatusMethodNotAllowed)
+
+	case ErrClientVersion:
+		// Tell the client which version we speak (RFC 6455, section 4.4)
+		w.Header().Set(swsvk, "13")
+		w.WriteHeader(httpcore.StatusUpgradeRequired)
+
+	case ErrBadOrigin:
+		w.WriteHeader(httpcore.StatusForbidden)
+
+	default:
+		w.WriteHeader(httpcore.StatusBadRequest)
+	}
+
+	w.Write([]byte(err.Error()))
+}
+
+// sameOrigin accepts requests without an Origin header and requests
+// whose Origin host is the requested Host.
+func sameOrigin(r *httpcore.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	_, host, found := strings.Cut(origin, "://")
+	if !found {
+		return false
+	}
+
+	return strings.EqualFold(host, r.Host)
+}
+
 // Sends 101 Switching Protocols response
 //
-// Adds Sec-WebSocket-Accept: <value> header
-func sendSwitchingProtoResponse(swsa string, conn net.Conn) {
-	res := httpcore.NewResponse(conn)
+// Adds Sec-WebSocket-Accept: <value> header, Sec-WebSocket-Protocol if
+// a subprotocol was selected and Sec-WebSocket-Extensions if an
+// extension was accepted
+func sendSwitchingProtoResponse(swsa, protocol, ext string, w *bufio.Writer, req *httpcore.Request) error {
+	res := httpcore.NewResponse(w, req)
 
 	// Set Sec-WebSocket-Accept and Sec-WebSocket-Version: 13 header
 	res.Header()[swsak] = []string{swsa}
 	res.Header().Set("Connection", "Upgrade")
 	res.Header().Set("Upgrade", "websocket")
 
+	if len(protocol) > 0 {
+		res.Header()[swspk] = []string{protocol}
+	}
+
+	if len(ext) > 0 {
+		res.Header()[swsek] = []string{ext}
+	}
+
 	// Set 101 status
 	res.WriteHeader(httpcore.StatusSwitchingProtocols)
 
-	res.FinalizeResponse(false, false)
+	if err := res.Flush(); err != nil {
+		return err
+	}
+
+	return w.Flush()
 }
 
 func computeWebsocketAccept(key string) string {
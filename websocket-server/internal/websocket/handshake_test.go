@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/suman7383/networking-from-scratch/httpcore"
+)
+
+// serveTestRouter serves router on a local listener and returns its
+// address. The listener lives as long as the test binary.
+func serveTestRouter(t *testing.T, router *httpcore.Router) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	go (&httpcore.Server{Handler: router}).Serve(ln)
+
+	return ln.Addr().String()
+}
+
+func dialTest(t *testing.T, addr, request string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatalf("writing request: %s", err)
+	}
+
+	return conn, bufio.NewReader(conn)
+}
+
+func upgradeRequest(path, extra string) string {
+	return "GET " + path + " HTTP/1.1\r\nHost: localhost\r\n" +
+		"Connection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" +
+		extra + "\r\n"
+}
+
+// maskedText builds a masked, final text frame as a client sends it.
+func maskedText(payload string) string {
+	mask := [4]byte{1, 2, 3, 4}
+
+	b := []byte{0x80 | byte(OpText), 0x80 | byte(len(payload))}
+	b = append(b, mask[:]...)
+
+	for i := 0; i < len(payload); i++ {
+		b = append(b, payload[i]^mask[i%4])
+	}
+
+	return string(b)
+}
+
+func TestUpgraderServesRoutesAndEndpoints(t *testing.T) {
+	var upgrader Upgrader
+
+	router := httpcore.NewRouter()
+	router.HandleRoute("GET /health", func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		w.Write([]byte("OK"))
+	})
+	router.Handle("GET /ws/echo", upgrader.Handler(func(w DataWriter, data []byte) {
+		w.Send(data, DataTypeText)
+	}))
+
+	addr := serveTestRouter(t, router)
+
+	_, br := dialTest(t, addr, "GET /health HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	if b, _ := io.ReadAll(br); !strings.HasPrefix(string(b), "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(string(b), "OK") {
+		t.Fatalf("Expected the health check, got %q", b)
+	}
+
+	// The first frame is sent along with the handshake
+	_, br = dialTest(t, addr, upgradeRequest("/ws/echo", "")+maskedText("hi"))
+
+	var head strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading handshake: %s", err)
+		}
+
+		if line == "\r\n" {
+			break
+		}
+
+		head.WriteString(line)
+	}
+
+	if !strings.HasPrefix(head.String(), "HTTP/1.1 101 Switching Protocols\r\n") ||
+		!strings.Contains(head.String(), "Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n") {
+		t.Fatalf("Unexpected handshake response %q", head.String())
+	}
+
+	frame := make([]byte, 4)
+	if _, err := io.ReadFull(br, frame); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+
+	if frame[0] != 0x80|byte(OpText) || frame[1] != 2 || string(frame[2:]) != "hi" {
+		t.Fatalf("Expected an unmasked text frame echoing \"hi\", got %q", frame)
+	}
+}
+
+func TestUpgraderRejectsBadRequests(t *testing.T) {
+	var upgrader Upgrader
+
+	router := httpcore.NewRouter()
+	router.Handle("GET /ws", upgrader.Handler(func(w DataWriter, data []byte) {}))
+
+	addr := serveTestRouter(t, router)
+
+	for request, status := range map[string]string{
+		"GET /ws HTTP/1.1\r\nHost: localhost\r\n\r\n":                              "400",
+		upgradeRequest("/ws", "Origin: https://evil.example\r\n"):                  "403",
+		strings.Replace(upgradeRequest("/ws", ""), "Version: 13", "Version: 8", 1): "426",
+	} {
+		_, br := dialTest(t, addr, request)
+
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading response: %s", err)
+		}
+
+		if !strings.HasPrefix(line, "HTTP/1.1 "+status+" ") {
+			t.Fatalf("Expected %s for %q, got %q", status, request, line)
+		}
+	}
+}
+
+func TestUpgraderSelectsSubprotocol(t *testing.T) {
+	upgrader := Upgrader{Subprotocols: []string{"chat.v2", "chat.v1"}}
+	strict := Upgrader{Subprotocols: []string{"graphql-transport-ws"}, RequireSubprotocol: true}
+
+	protocols := make(chan string, 1)
+
+	router := httpcore.NewRouter()
+	router.HandleRoute("GET /ws", func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		wsc, err := upgrader.Upgrade(w, r, func(w DataWriter, data []byte) {})
+		if err != nil {
+			return
+		}
+
+		protocols <- wsc.Subprotocol()
+		wsc.Handle()
+	})
+	router.Handle("GET /strict", strict.Handler(func(w DataWriter, data []byte) {}))
+
+	addr := serveTestRouter(t, router)
+
+	for _, tc := range []struct {
+		offer string
+		want  string
+	}{
+		// The server's preference wins
+		{"Sec-WebSocket-Protocol: chat.v1, chat.v2\r\n", "chat.v2"},
+		{"Sec-WebSocket-Protocol: other\r\nSec-WebSocket-Protocol: chat.v1\r\n", "chat.v1"},
+		{"Sec-WebSocket-Protocol: CHAT.V1\r\n", ""},
+		{"", ""},
+	} {
+		_, br := dialTest(t, addr, upgradeRequest("/ws", tc.offer))
+
+		var header string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading handshake: %s", err)
+			}
+
+			if line == "\r\n" {
+				break
+			}
+
+			if v, ok := strings.CutPrefix(line, "Sec-WebSocket-Protocol: "); ok {
+				header = strings.TrimSpace(v)
+			}
+		}
+
+		if got := <-protocols; got != tc.want || header != tc.want {
+			t.Errorf("%q: selected %q, answered %q, want %q", tc.offer, got, header, tc.want)
+		}
+	}
+
+	for offer, status := range map[string]string{
+		"Sec-WebSocket-Protocol: graphql-ws\r\n": "400",
+		"":                                       "400",
+		"Sec-WebSocket-Protocol: graphql-transport-ws\r\n": "101",
+	} {
+		_, br := dialTest(t, addr, upgradeRequest("/strict", offer))
+
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading response: %s", err)
+		}
+
+		if !strings.HasPrefix(line, "HTTP/1.1 "+status+" ") {
+			t.Errorf("Expected %s for %q, got %q", status, offer, line)
+		}
+	}
+}
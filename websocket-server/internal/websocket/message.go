@@ -0,0 +1,274 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+
+	"github.com/suman7383/networking-from-scratch/websocket-server/utils"
+)
+
+var ErrWriterClosed = errors.New("message writer closed")
+
+// NextReader waits for the next message and returns its type and a
+// reader over its payload. Fragments are read as the reader needs
+// them, so the message is never held in memory whole. What is left
+// of the previous message is skipped.
+//
+// Only one goroutine may read messages. The error is final: the
+// connection is closed, io.EOF means after a closing handshake.
+func (w *WebSocketConn) NextReader() (DataType, io.Reader, error) {
+	// Skip the rest of the previous message
+	if w.reader != nil {
+		io.Copy(io.Discard, w.reader)
+		w.reader = nil
+	}
+
+	for {
+		fr, err := w.nextDataFrame()
+		if err != nil {
+			return "", nil, err
+		}
+
+		if fr.Opcode == OpContinuation {
+			utils.LogErr("reading message", ErrUnexpectedContinuation)
+			w.initiateClose(CloseProtocolErr, CloseProtocolErr.String())
+
+			continue
+		}
+
+		mr := &messageReader{c: w}
+		if err := mr.add(fr); err != nil {
+			continue
+		}
+
+		w.reader = mr
+		if fr.Rsv1 {
+			w.reader = w.inflate(mr)
+		}
+
+		return dataType(fr.Opcode), w.reader, nil
+	}
+}
+
+// messageReader reads the payload of a message, frame by frame.
+type messageReader struct {
+	c       *WebSocketConn
+	payload []byte // unread payload of the current frame
+	size    int64  // payload of all frames so far
+	fin     bool   // the current frame is the last one
+	err     error
+}
+
+func (mr *messageReader) Read(p []byte) (int, error) {
+	for len(mr.payload) == 0 && mr.err == nil {
+		if mr.fin {
+			mr.err = io.EOF
+			break
+		}
+
+		fr, err := mr.c.nextDataFrame()
+		if err != nil {
+			mr.err = io.ErrUnexpectedEOF
+			break
+		}
+
+		// A new message can't start before this one ended
+		if fr.Opcode != OpContinuation {
+			mr.fail(ErrMessageInterrupted, CloseProtocolErr)
+			break
+		}
+
+		mr.add(fr)
+	}
+
+	if len(mr.payload) > 0 {
+		n := copy(p, mr.payload)
+		mr.payload = mr.payload[n:]
+
+		return n, nil
+	}
+
+	return 0, mr.err
+}
+
+// add makes fr the current frame, unless the message grows over the
+// connection's max message size.
+func (mr *messageReader) add(fr *Frame) error {
+	mr.size += int64(len(fr.Payload))
+
+	if mr.size > mr.c.maxMessageSize {
+		return mr.fail(ErrMessageTooBig, CloseMessageTooBig)
+	}
+
+	mr.payload, mr.fin = fr.Payload, fr.Fin
+
+	return nil
+}
+
+// fail starts the closing handshake with code, the message can't be
+// read any further.
+func (mr *messageReader) fail(err error, code CloseStatus) error {
+	utils.LogErr("reading message", err)
+	mr.c.initiateClose(code, code.String())
+
+	mr.payload, mr.err = nil, err
+
+	return err
+}
+
+// NextWriter returns a writer for a new message of type dt. Written
+// data is sent in frames of up to DefaultFragmentSize as the buffer
+// fills, Close sends the final frame. If permessage-deflate was
+// negotiated, messages reaching the compression threshold are
+// compressed.
+//
+// Messages are not mixed: until the writer is closed, NextWriter
+// and DataWriter.Send in other goroutines wait for it.
+func (w *WebSocketConn) NextWriter(dt DataType) (io.WriteCloser, error) {
+	w.w.sendMu.Lock()
+
+	if w.closing() {
+		w.w.sendMu.Unlock()
+
+		return nil, ErrConnectionClosing
+	}
+
+	op := OpBinary
+	if dt == DataTypeText {
+		op = OpText
+	}
+
+	return &messageWriter{
+		c:   w,
+		op:  op,
+		buf: make([]byte, 0, max(w.w.fragmentSize, 1)),
+	}, nil
+}
+
+// messageWriter buffers a message and writes it a frame at a time.
+type messageWriter struct {
+	c      *WebSocketConn
+	op     Opcode // of the next frame, OpContinuation after the first
+	rsv1   bool   // the message is compressed
+	buf    []byte
+	closed bool
+	err    error
+
+	pending     []byte // data held until the compression threshold
+	compressing bool
+	held        []byte // last bytes of compressed data
+}
+
+func (mw *messageWriter) Write(p []byte) (int, error) {
+	if mw.closed {
+		return 0, ErrWriterClosed
+	}
+
+	if !mw.c.compress || mw.err != nil {
+		return mw.writeFrames(p)
+	}
+
+	if !mw.compressing {
+		if len(mw.pending)+len(p) < mw.c.compressThreshold {
+			mw.pending = append(mw.pending, p...)
+
+			return len(p), nil
+		}
+
+		mw.startCompression()
+	}
+
+	n, err := mw.c.deflater.Write(p)
+	if err != nil && mw.err == nil {
+		mw.err = err
+	}
+
+	return n, mw.err
+}
+
+// writeFrames adds p to the frame buffer, sending it as a frame each
+// time it is full.
+func (mw *messageWriter) writeFrames(p []byte) (int, error) {
+	n := 0
+
+	for len(p) > 0 && mw.err == nil {
+		// Only send a full buffer once more data comes, the final
+		// frame is never empty unless the message is
+		if len(mw.buf) == cap(mw.buf) {
+			mw.flush(false)
+			continue
+		}
+
+		k := copy(mw.buf[len(mw.buf):cap(mw.buf)], p)
+		mw.buf = mw.buf[:len(mw.buf)+k]
+
+		n += k
+		p = p[k:]
+	}
+
+	return n, mw.err
+}
+
+// Close sends the final frame of the message.
+func (mw *messageWriter) Close() error {
+	if mw.closed {
+		return nil
+	}
+
+	mw.closed = true
+	defer mw.c.w.sendMu.Unlock()
+
+	switch {
+	case mw.compressing:
+		mw.finishCompression()
+	case len(mw.pending) > 0:
+		// Under the threshold, sent as is
+		mw.writeFrames(mw.pending)
+	}
+
+	if mw.err == nil {
+		mw.flush(true)
+	}
+
+	return mw.err
+}
+
+func (mw *messageWriter) flush(fin bool) {
+	fr := &Frame{
+		Fin:        fin,
+		Rsv1:       mw.rsv1 && mw.op != OpContinuation,
+		Opcode:     mw.op,
+		Masked:     false,
+		PayloadLen: uint64(len(mw.buf)),
+		Payload:    mw.buf,
+	}
+
+	mw.err = mw.c.writeFrame(fr)
+
+	mw.op = OpContinuation
+	mw.buf = mw.buf[:0]
+}
+
+// Send writes data as one message, it makes the connection a
+// DataWriter. A write error starts the closing handshake.
+func (w *WebSocketConn) Send(data []byte, dt DataType) {
+	mw, err := w.NextWriter(dt)
+	if err != nil {
+		return
+	}
+
+	mw.Write(data)
+
+	if err := mw.Close(); err != nil && err != ErrConnectionClosing {
+		utils.LogErr("sending message", err)
+		w.initiateClose(CloseInternalError, CloseInternalError.String())
+	}
+}
+
+func dataType(op Opcode) DataType {
+	if op == OpText {
+		return DataTypeText
+	}
+
+	return DataTypeBinary
+}
@@ -4,23 +4,34 @@ import (
 	"bufio"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
-	"net"
 
 	"github.com/suman7383/networking-from-scratch/websocket-server/utils"
 )
 
 type FrameReader struct {
-	r       *bufio.Reader
-	closeCh chan struct{}
+	r *bufio.Reader
+
+	// maxFrameSize limits the payload of one frame, zero means no limit
+	maxFrameSize uint64
+
+	// allowRsv1 accepts RSV1 on the first frame of a message, it
+	// marks compressed messages once permessage-deflate is negotiated
+	allowRsv1 bool
 }
 
-func NewFrameReader(conn net.Conn) *FrameReader {
-	return &FrameReader{
-		r:       bufio.NewReader(conn),
-		closeCh: make(chan struct{}),
+// NewFrameReader returns a FrameReader reading from r. A
+// *bufio.Reader is used as is, so bytes it already buffered are
+// read as frames too.
+func NewFrameReader(r io.Reader) *FrameReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
 	}
+
+	return &FrameReader{r: br}
 }
 
 var ErrReadingInfo = errors.New("could not read frame")
@@ -62,19 +73,23 @@ func (fr *FrameReader) ReadFrame() (*Frame, error) {
 }
 
 const fin_mask = (1 << 7)            // 7th bit
-const rsv_mask = ((1 << 3) - 1) << 4 // 4th, 5th, 6th bits (We do not care about RSV bits now)
+const rsv_mask = ((1 << 3) - 1) << 4 // 4th, 5th, 6th bits
+const rsv1_mask = (1 << 6)           // 6th bit, permessage-deflate
 const opcode_mask = (1 << 4) - 1     // 0 to 3rd bits set
 const maskP_mask = (1 << 7)          // 7th bit
 const payloadLen_mask = (1 << 7) - 1 // 0 to 6th bits set
 
-var ErrUnsupportedFragmentation = errors.New("fragmentation not supported")
 var ErrExtensionNotSupported = errors.New("extension not supported")
 var ErrProtocol = errors.New("protocol error")
 var ErrPayloadTooLarge = errors.New("payload is too large")
 
+// DefaultMaxFrameSize limits the payload of a single frame when
+// Upgrader.MaxFrameSize is not set.
+const DefaultMaxFrameSize = 1 << 20 // 1 MiB
+
 // parseFrameInfo reads from conn and forms these following data:
 //
-// FIN- whether it is final frame(we only expect FIN 1, fragmentation is unsupported)
+// FIN- whether it is the final frame of a message(0 means more fragments follow)
 //
 // OPCODE- Type of frame(continuation, text, binary, close, ping, pong)
 //
@@ -92,7 +107,8 @@ func (fr *FrameReader) parseFrameInfo(f *Frame) error {
 	// payload length:
 	// 0-125: payload length
 	// 126: next 2 bytes = actual length (return error if control frame or actual length < 126)
-	// 127: next 8 bytes = actual length (not-supported here so we return error if 127)
+	// 127: next 8 bytes = actual length (return error if control frame, actual length <= 65535
+	// or most significant bit set)
 	info := make([]byte, 2)
 
 	if _, err := io.ReadFull(fr.r, info); err != nil {
@@ -102,20 +118,15 @@ func (fr *FrameReader) parseFrameInfo(f *Frame) error {
 	}
 
 	// FIN
-	fin := info[0] & fin_mask
-
-	if fin == 0 {
-		return ErrUnsupportedFragmentation
-	}
-
-	f.Fin = true
+	f.Fin = info[0]&fin_mask != 0
 
 	// RSV
 	//
-	// We ignore if rsv is 0 but throw error if > 0
+	// Only RSV1 has a meaning, once permessage-deflate is negotiated
 	rsv := info[0] & rsv_mask
+	f.Rsv1 = rsv&rsv1_mask != 0 && fr.allowRsv1
 
-	if rsv > 0 {
+	if rsv&^rsv1_mask > 0 || (rsv > 0 && !f.Rsv1) {
 		return ErrExtensionNotSupported
 	}
 
@@ -123,6 +134,18 @@ func (fr *FrameReader) parseFrameInfo(f *Frame) error {
 	opcode := info[0] & opcode_mask
 	f.Opcode = Opcode(opcode)
 
+	// Only the first frame of a data message is marked compressed
+	// (RFC 7692, section 6.1)
+	if f.Rsv1 && (f.Opcode.IsControlFrame() || f.Opcode == OpContinuation) {
+		return ErrProtocol
+	}
+
+	// Control frames may be sent in the middle of a fragmented
+	// message, but can't be fragmented themselves (RFC 6455, section 5.5)
+	if !f.Fin && f.Opcode.IsControlFrame() {
+		return ErrProtocol
+	}
+
 	// MASK
 	maskP := info[1] & maskP_mask
 	if maskP == 0 {
@@ -133,11 +156,26 @@ func (fr *FrameReader) parseFrameInfo(f *Frame) error {
 
 	// PAYLOAD Len
 	// Check for len 127, 126 and <125
-	//
-	// 127 not supported for now
 	switch payloadLen := info[1] & payloadLen_mask; payloadLen {
 	case 127:
-		return ErrPayloadTooLarge
+		// Throw if Control frame
+		if f.Opcode.IsControlFrame() {
+			return ErrProtocol
+		}
+
+		// Read next 8 bytes to get actual length
+		epl, err := fr.readExtPayloadLen64()
+		if err != nil {
+			return err
+		}
+
+		// The most significant bit must be 0 and the length must not
+		// fit in 16 bits (RFC 6455, section 5.2)
+		if epl>>63 != 0 || epl <= 0xFFFF {
+			return ErrProtocol
+		}
+
+		f.PayloadLen = epl
 	case 126:
 		// Throw if Control frame
 		if f.Opcode.IsControlFrame() {
@@ -153,11 +191,16 @@ func (fr *FrameReader) parseFrameInfo(f *Frame) error {
 				return ErrProtocol
 			}
 
-			f.PayloadLen = epl
+			f.PayloadLen = uint64(epl)
 		}
 	default:
 		// payloadLen is <=125
-		f.PayloadLen = uint16(payloadLen)
+		f.PayloadLen = uint64(payloadLen)
+	}
+
+	// Don't allocate a payload we are not willing to read
+	if fr.maxFrameSize > 0 && f.PayloadLen > fr.maxFrameSize {
+		return fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, f.PayloadLen)
 	}
 
 	return nil
@@ -170,12 +213,25 @@ func (fr *FrameReader) readExtPayloadLen16() (len uint16, err error) {
 	if _, err := io.ReadFull(fr.r, extPayloadLen); err != nil {
 		slog.Error("could not read extended payload length", slog.String("err", err.Error()))
 
-		return 0, ErrReadingInfo
+		return 0, fmt.Errorf("%w: %w", ErrReadingInfo, err)
 	}
 
 	return binary.BigEndian.Uint16(extPayloadLen), nil
 }
 
+// Reads next 8 bytes(64 bit)
+func (fr *FrameReader) readExtPayloadLen64() (len uint64, err error) {
+	extPayloadLen := make([]byte, 8)
+
+	if _, err := io.ReadFull(fr.r, extPayloadLen); err != nil {
+		slog.Error("could not read extended payload length", slog.String("err", err.Error()))
+
+		return 0, fmt.Errorf("%w: %w", ErrReadingInfo, err)
+	}
+
+	return binary.BigEndian.Uint64(extPayloadLen), nil
+}
+
 // Reads the mask key used for unmasking payload data
 func (fr *FrameReader) readMaskKey() (key []byte, err error) {
 	// Read 4 bytes
@@ -183,14 +239,14 @@ func (fr *FrameReader) readMaskKey() (key []byte, err error) {
 
 	_, err = io.ReadFull(fr.r, key)
 	if err != nil {
-		return nil, ErrReadingInfo
+		return nil, fmt.Errorf("%w: %w", ErrReadingInfo, err)
 	}
 
 	return key, nil
 }
 
 // Reads the masked payload data
-func (fr *FrameReader) readPayload(payloadLen uint16) (data []byte, err error) {
+func (fr *FrameReader) readPayload(payloadLen uint64) (data []byte, err error) {
 	data = make([]byte, payloadLen)
 
 	_, err = io.ReadFull(fr.r, data)
@@ -3,49 +3,79 @@ package websocket
 import (
 	"bufio"
 	"encoding/binary"
-	"net"
+	"io"
+	"sync"
 
 	"github.com/suman7383/networking-from-scratch/websocket-server/utils"
 )
 
 type FrameWriter struct {
-	w       *bufio.Writer
-	closeCh chan struct{}
+	mu     sync.Mutex // frames are written whole, e.g. a close frame sent on shutdown
+	sendMu sync.Mutex // fragments of a message are not mixed with another message
+	w      *bufio.Writer
+
+	// fragmentSize is the largest payload a message writer puts in
+	// one frame
+	fragmentSize int
 }
 
-func NewFrameWriter(conn net.Conn) *FrameWriter {
+// DefaultFragmentSize is the largest payload a message writer puts
+// in one frame, longer messages are fragmented.
+const DefaultFragmentSize = 1 << 16 // 64 KiB
+
+// NewFrameWriter returns a FrameWriter writing to w. A
+// *bufio.Writer is used as is.
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+	}
+
 	return &FrameWriter{
-		w:       bufio.NewWriter(conn),
-		closeCh: make(chan struct{}),
+		w:            bw,
+		fragmentSize: DefaultFragmentSize,
 	}
 }
 
 func (fw *FrameWriter) WriteFrame(f *Frame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
 	// Write 2 bytes
 	//
-	// FIN(1 bit): 1, RSV(3 bit): 0
+	// FIN(1 bit), RSV1(1 bit), RSV2-3(2 bit): 0
 	// OPCODE(4 bits), MASK(1 bit): 0
 	// BASE PAYLOAD(7 bits)
-	// payload length:
-	// 0-125: payload length
 	//
 	// payload length
 	// 0-125: payload length
 	// 126: next 2 bytes = actual length
-	// 127: next 8 bytes = actual length (not-supported here)
+	// 127: next 8 bytes = actual length
 	info := make([]byte, 2)
 
-	info[0] = (1 << 7)        // FIN = 1 (bit 7)
+	if f.Fin {
+		info[0] = fin_mask // FIN = 1 (bit 7)
+	}
+	if f.Rsv1 {
+		info[0] |= rsv1_mask // RSV1 = 1 (bit 6)
+	}
 	info[0] |= byte(f.Opcode) // OPCODE in bits 0-3
 
 	// payload len
-	//
-	// 0 - 125: payload length
-	if f.PayloadLen < 126 {
+	var extLen []byte
+
+	switch {
+	case f.PayloadLen < 126:
+		// 0 - 125: payload length
 		info[1] = byte(f.PayloadLen)
-	} else {
+	case f.PayloadLen <= 0xFFFF:
 		// 126: next 2 bytes = actual length
 		info[1] = 126
+		extLen = binary.BigEndian.AppendUint16(nil, uint16(f.PayloadLen))
+	default:
+		// 127: next 8 bytes = actual length
+		info[1] = 127
+		extLen = binary.BigEndian.AppendUint64(nil, f.PayloadLen)
 	}
 
 	// Write the first 2 bytes
@@ -57,10 +87,7 @@ func (fw *FrameWriter) WriteFrame(f *Frame) error {
 	}
 
 	// EXT payload len
-	if f.PayloadLen >= 126 {
-		extLen := make([]byte, 2)
-		binary.BigEndian.PutUint16(extLen, f.PayloadLen)
-
+	if len(extLen) > 0 {
 		err := fw.write(extLen)
 		if err != nil {
 			utils.LogErr("could not write EXT PAYLOAD Len to conn", err)
@@ -91,31 +118,6 @@ func (fw *FrameWriter) write(b []byte) error {
 	return nil
 }
 
-func (fw *FrameWriter) Send(data []byte, dt DataType) {
-	// Write data Frame
-	var op Opcode
-
-	if dt == DataTypeText {
-		op = OpText
-	} else {
-		op = OpBinary
-	}
-
-	fr := &Frame{
-		Fin:        true,
-		Opcode:     op,
-		Masked:     false,
-		PayloadLen: uint16(len(data)),
-		Payload:    data,
-	}
-
-	err := fw.WriteFrame(fr)
-	if err != nil {
-		// Inform about an error to initiate close
-		fw.closeCh <- struct{}{}
-	}
-}
-
 func (fw *FrameWriter) flush() {
 	if err := fw.w.Flush(); err != nil {
 		utils.LogErr("could not flush data", err)